@@ -0,0 +1,209 @@
+package xbnf
+
+import (
+	"fmt"
+	"sort"
+	"unicode/utf8"
+)
+
+const (
+	maxSamples     = 64 // max number of sample texts generated for a rule
+	maxSampleDepth = 6  // max depth of rule references followed to generate a sample text
+)
+
+// Ambiguity is a pair of unordered alternatives of a choice that match the same text, ie. the
+// witness. Evaluating the choice on the witness fails with an ambiguity error.
+type Ambiguity struct {
+	Rule    string // name of the rule having the choice
+	File    string // file defining the rule, if available
+	Line    int    // line defining the rule
+	First   IRule
+	Second  IRule
+	Witness string
+}
+
+func (inst *Ambiguity) String() string {
+	msg := fmt.Sprintf("rule [%s] - alternatives %s and %s are ambiguous, both match %q", inst.Rule, inst.First.String(), inst.Second.String(), inst.Witness)
+	if inst.File == "" {
+		return fmt.Sprintf("L#%d: %s", inst.Line, msg)
+	}
+	return fmt.Sprintf("%s: L#%d: %s", inst.File, inst.Line, msg)
+}
+
+// Ambiguities finds the pairs of alternatives in the same group of a choice that can match the
+// same text. Sample texts are generated from both alternatives, the ones matched by both are the
+// witnesses. It's not exhaustive, an ambiguity is reported only if a witness is found.
+func (inst *Grammar) Ambiguities() ([]*Ambiguity, error) {
+	if err := inst.Validate(); err != nil {
+		return nil, err
+	}
+	analysis := inst.Analysis()
+	prober := inst.prober()
+	var ambiguities []*Ambiguity
+	for name, record := range inst.ruleRecords {
+		walkRule(record.rule, func(rule IRule) {
+			choice, ok := rule.(*ChoiceRule)
+			if !ok {
+				return
+			}
+			for _, group := range choice.groups {
+				for i, first := range group {
+					for _, second := range group[i+1:] {
+						witness, found := prober.findWitness(analysis, first, second)
+						if !found {
+							continue
+						}
+						ambiguities = append(ambiguities, &Ambiguity{
+							Rule:    name,
+							File:    record.file,
+							Line:    record.line,
+							First:   first,
+							Second:  second,
+							Witness: witness,
+						})
+					}
+				}
+			}
+		})
+	}
+	sort.Slice(ambiguities, func(i, j int) bool {
+		return ambiguities[i].String() < ambiguities[j].String()
+	})
+	return ambiguities, nil
+}
+
+// findWitness finds the shortest sample text of both alternatives that both match fully
+func (inst *Grammar) findWitness(analysis *Analysis, first IRule, second IRule) (string, bool) {
+	if !analysis.NullableOf(first) && !analysis.NullableOf(second) &&
+		!analysis.FirstOf(first).Intersects(analysis.FirstOf(second)) {
+		return "", false // they never start with the same char
+	}
+	samples := inst.samples(first, maxSampleDepth)
+	samples = append(samples, inst.samples(second, maxSampleDepth)...)
+	sort.SliceStable(samples, func(i, j int) bool {
+		return len(samples[i]) < len(samples[j])
+	})
+	for _, sample := range samples {
+		if inst.matchesFully(first, sample) && inst.matchesFully(second, sample) {
+			return sample, true
+		}
+	}
+	return "", false
+}
+
+// prober returns a copy of the grammar to evaluate the sample texts with. The memo, the tracer
+// and the profiler are off, so the probes don't show up in the statistics of the grammar.
+func (inst *Grammar) prober() *Grammar {
+	prober := *inst
+	prober.memoEnabled = false
+	prober.tracer = nil
+	prober.profiler = nil
+	prober.state = nil
+	return &prober
+}
+
+// matchesFully checks whether the rule matches all chars of the text
+func (inst *Grammar) matchesFully(rule IRule, text string) bool {
+	defer inst.beginEval()()
+	inst.silence(true)
+	cs := NewCharstreamFromString(text)
+	result := rule.Eval(inst, cs, NOT_SKIP)
+	return result.Node != nil && result.End == utf8.RuneCountInString(text)
+}
+
+// samples generates some texts the rule may match, the depth limits the rule references followed
+func (inst *Grammar) samples(rule IRule, depth int) []string {
+	var samples []string
+	switch r := rule.(type) {
+	case *TerminalStringRule:
+		samples = []string{string(r.text)}
+	case *TerminalCharsRule:
+		samples = []string{string(r.text)}
+	case *TerminalCharRule:
+		samples = []string{string(r.text)}
+	case *TerminalRangeRule, *TerminalClassRule, *TerminalSetRule, *TerminalAnyRule:
+		samples = sampleChars(inst.Analysis().FirstOf(rule))
+	case *EOFRule, *PredicateRule:
+		samples = []string{""}
+	case *ReferenceRule:
+		if record := inst.GetRecord(r.refName); record != nil && depth > 0 {
+			samples = inst.samples(record.rule, depth-1)
+		}
+	case *OptionRule:
+		samples = append([]string{""}, inst.samples(r.rule, depth)...)
+	case *GroupRule:
+		samples = inst.samples(r.rule, depth)
+	case *DifferenceRule:
+		samples = inst.samples(r.rule, depth)
+	case *ChoiceRule:
+		for _, sub := range subRules(r) {
+			samples = append(samples, inst.samples(sub, depth)...)
+		}
+	case *ConcatenateRule:
+		samples = []string{""}
+		for _, child := range r.rules {
+			samples = product(samples, inst.samples(child, depth))
+		}
+	case *RepetitionRule:
+		once := inst.samples(r.rule, depth)
+		repeated := []string{""}
+		for i := uint(0); i < r.min; i++ {
+			repeated = product(repeated, once)
+		}
+		samples = repeated
+		for i := r.min; i < r.min+2 && (r.max == 0 || i < r.max); i++ {
+			repeated = product(repeated, once)
+			samples = append(samples, repeated...)
+		}
+	case *BlockRule:
+		open := inst.samples(r.open, depth)
+		content := product(open, []string{"", "x"})
+		if r.virtualClose {
+			samples = content
+		} else {
+			samples = product(content, inst.samples(r.close, depth))
+		}
+	}
+	if len(samples) > maxSamples {
+		samples = samples[:maxSamples]
+	}
+	return samples
+}
+
+// product returns the concatenations of every text of a and every text of b
+func product(a []string, b []string) []string {
+	var result []string
+	for _, x := range a {
+		for _, y := range b {
+			result = append(result, x+y)
+			if len(result) >= maxSamples {
+				return result
+			}
+		}
+	}
+	return result
+}
+
+// sampleChars picks the first and last visible ascii chars of a set, or the first char of the
+// set if it has no visible ascii char.
+func sampleChars(set *CharSet) []string {
+	var chars []string
+	for char := rune('!'); char <= '~'; char++ {
+		if set.Contains(char) {
+			chars = append(chars, string(char))
+			break
+		}
+	}
+	for char := rune('~'); char > '!'; char-- {
+		if set.Contains(char) {
+			if len(chars) == 0 || chars[0] != string(char) {
+				chars = append(chars, string(char))
+			}
+			break
+		}
+	}
+	if len(chars) == 0 && len(set.Ranges) > 0 {
+		chars = append(chars, string(set.Ranges[0].Lo))
+	}
+	return chars
+}
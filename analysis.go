@@ -0,0 +1,539 @@
+package xbnf
+
+import (
+	"fmt"
+	"sort"
+	"strings"
+	"unicode"
+)
+
+// nullable returns true if the rule can match without using any char. The nullables of the
+// named rules are looked up in the nullables map.
+func nullable(rule IRule, nullables map[string]bool) bool {
+	switch r := rule.(type) {
+	case *TerminalStringRule:
+		return len(r.text) == 0
+	case *TerminalCharsRule:
+		return len(r.text) == 0
+	case *EOFRule:
+		return true
+	case *ReferenceRule:
+		return nullables[r.refName]
+	case *GroupRule:
+		return nullable(r.rule, nullables)
+	case *DifferenceRule:
+		return nullable(r.rule, nullables)
+	case *OptionRule, *PredicateRule:
+		return true
+	case *RepetitionRule:
+		return r.min == 0 || nullable(r.rule, nullables)
+	case *ConcatenateRule:
+		for _, child := range r.rules {
+			if !nullable(child, nullables) {
+				return false
+			}
+		}
+		return true
+	case *ChoiceRule:
+		for _, group := range r.groups {
+			for _, child := range group {
+				if nullable(child, nullables) {
+					return true
+				}
+			}
+		}
+		return false
+	case *BlockRule:
+		return nullable(r.open, nullables) && (r.virtualClose || nullable(r.close, nullables))
+	}
+	return false // single char terminals
+}
+
+// subRules returns the rules a rule is composed of, in the order they are written.
+func subRules(rule IRule) []IRule {
+	switch r := rule.(type) {
+	case *GroupRule:
+		return []IRule{r.rule}
+	case *OptionRule:
+		return []IRule{r.rule}
+	case *PredicateRule:
+		return []IRule{r.rule}
+	case *DifferenceRule:
+		return []IRule{r.rule, r.excluded}
+	case *RepetitionRule:
+		return []IRule{r.rule}
+	case *ConcatenateRule:
+		return r.rules
+	case *ChoiceRule:
+		var rules []IRule
+		for _, group := range r.groups {
+			rules = append(rules, group...)
+		}
+		return rules
+	case *BlockRule:
+		rules := []IRule{r.open}
+		if r.escape != nil {
+			rules = append(rules, r.escape)
+		}
+		rules = append(rules, r.excludes...)
+		return append(rules, r.close)
+	}
+	return nil
+}
+
+// walkRule calls visit on the rule and all its sub rules, depth first.
+func walkRule(rule IRule, visit func(rule IRule)) {
+	visit(rule)
+	for _, sub := range subRules(rule) {
+		walkRule(sub, visit)
+	}
+}
+
+// nullableRules finds all named rules that can match without using any char.
+func (inst *Grammar) nullableRules() map[string]bool {
+	nullables := make(map[string]bool)
+	for changed := true; changed; {
+		changed = false
+		for name, record := range inst.ruleRecords {
+			if !nullables[name] && nullable(record.rule, nullables) {
+				nullables[name] = true
+				changed = true
+			}
+		}
+	}
+	return nullables
+}
+
+// leftRefs collects the names of the rules that may be evaluated at the same cursor where the
+// rule starts, ie. before the rule uses any char.
+func leftRefs(rule IRule, nullables map[string]bool, refs map[string]bool) {
+	switch r := rule.(type) {
+	case *ReferenceRule:
+		refs[r.refName] = true
+	case *GroupRule:
+		leftRefs(r.rule, nullables, refs)
+	case *OptionRule:
+		leftRefs(r.rule, nullables, refs)
+	case *PredicateRule:
+		leftRefs(r.rule, nullables, refs)
+	case *DifferenceRule:
+		// both rules are evaluated at the same cursor
+		leftRefs(r.rule, nullables, refs)
+		leftRefs(r.excluded, nullables, refs)
+	case *RepetitionRule:
+		leftRefs(r.rule, nullables, refs)
+	case *ConcatenateRule:
+		for _, child := range r.rules {
+			leftRefs(child, nullables, refs)
+			if !nullable(child, nullables) {
+				break
+			}
+		}
+	case *ChoiceRule:
+		for _, group := range r.groups {
+			for _, child := range group {
+				leftRefs(child, nullables, refs)
+			}
+		}
+	case *BlockRule:
+		leftRefs(r.open, nullables, refs)
+		if nullable(r.open, nullables) {
+			// escape, excludes and close are all evaluated right after the open
+			if r.escape != nil {
+				leftRefs(r.escape, nullables, refs)
+			}
+			for _, exclude := range r.excludes {
+				leftRefs(exclude, nullables, refs)
+			}
+			leftRefs(r.close, nullables, refs)
+		}
+	}
+}
+
+// leftRecursion describes the left-recursive rules of a grammar, ie. the rules that may
+// evaluate themselves again at the same cursor.
+type leftRecursion struct {
+	cycles  [][]string      // a cycle of each group of mutually left-recursive rules, eg. [a b a]
+	rules   map[string]bool // all rules in the cycles
+	leaders map[string]bool // rules that grow their results, evaluating them breaks all cycles
+	err     error           // set if a group of rules has no single leader
+}
+
+// analyzeLeftRecursion finds the groups of mutually left-recursive rules (strongly connected
+// components of the left call graph), and picks a leader in each group. A leader is a rule
+// whose removal leaves no cycle in its group.
+func (inst *Grammar) analyzeLeftRecursion() *leftRecursion {
+	nullables := inst.nullableRules()
+	graph := make(map[string][]string)
+	var names []string
+	for name, record := range inst.ruleRecords {
+		refs := make(map[string]bool)
+		leftRefs(record.rule, nullables, refs)
+		for ref := range refs {
+			if _, exists := inst.ruleRecords[ref]; exists {
+				graph[name] = append(graph[name], ref)
+			}
+		}
+		sort.Strings(graph[name])
+		names = append(names, name)
+	}
+	sort.Strings(names)
+
+	lr := &leftRecursion{
+		rules:   make(map[string]bool),
+		leaders: make(map[string]bool),
+	}
+	for _, scc := range stronglyConnected(names, graph) {
+		members := make(map[string]bool)
+		for _, name := range scc {
+			members[name] = true
+		}
+		if len(scc) == 1 && !contains(graph[scc[0]], scc[0]) {
+			continue // not recursive
+		}
+		for _, name := range scc {
+			lr.rules[name] = true
+		}
+		leader := ""
+		for _, name := range scc {
+			delete(members, name)
+			acyclic := !hasCycle(members, graph)
+			members[name] = true
+			if acyclic {
+				leader = name
+				break
+			}
+		}
+		if leader == "" {
+			leader = scc[0]
+			if lr.err == nil {
+				lr.err = fmt.Errorf("left recursion of rules %s can't be broken by a single rule",
+					strings.Join(scc, ", "))
+			}
+		} else {
+			lr.leaders[leader] = true
+		}
+		lr.cycles = append(lr.cycles, findCycle(leader, members, graph))
+	}
+	return lr
+}
+
+// stronglyConnected returns the strongly connected components of the graph, each sorted by
+// name, using Tarjan's algorithm.
+func stronglyConnected(names []string, graph map[string][]string) [][]string {
+	index := make(map[string]int)
+	lowlink := make(map[string]int)
+	onStack := make(map[string]bool)
+	var stack []string
+	var sccs [][]string
+	var connect func(name string)
+	connect = func(name string) {
+		index[name] = len(index)
+		lowlink[name] = index[name]
+		stack = append(stack, name)
+		onStack[name] = true
+		for _, next := range graph[name] {
+			if _, visited := index[next]; !visited {
+				connect(next)
+				if lowlink[next] < lowlink[name] {
+					lowlink[name] = lowlink[next]
+				}
+			} else if onStack[next] && index[next] < lowlink[name] {
+				lowlink[name] = index[next]
+			}
+		}
+		if lowlink[name] == index[name] {
+			var scc []string
+			for {
+				top := stack[len(stack)-1]
+				stack = stack[:len(stack)-1]
+				onStack[top] = false
+				scc = append(scc, top)
+				if top == name {
+					break
+				}
+			}
+			sort.Strings(scc)
+			sccs = append(sccs, scc)
+		}
+	}
+	for _, name := range names {
+		if _, visited := index[name]; !visited {
+			connect(name)
+		}
+	}
+	sort.Slice(sccs, func(i, j int) bool { return sccs[i][0] < sccs[j][0] })
+	return sccs
+}
+
+// hasCycle checks whether the subgraph of the members has a cycle
+func hasCycle(members map[string]bool, graph map[string][]string) bool {
+	const (
+		visiting = 1
+		done     = 2
+	)
+	states := make(map[string]int)
+	var visit func(name string) bool
+	visit = func(name string) bool {
+		states[name] = visiting
+		for _, next := range graph[name] {
+			if !members[next] {
+				continue
+			}
+			if states[next] == visiting || (states[next] == 0 && visit(next)) {
+				return true
+			}
+		}
+		states[name] = done
+		return false
+	}
+	for name := range members {
+		if states[name] == 0 && visit(name) {
+			return true
+		}
+	}
+	return false
+}
+
+// findCycle returns a shortest path from the rule back to itself within the members
+func findCycle(start string, members map[string]bool, graph map[string][]string) []string {
+	from := make(map[string]string)
+	queue := []string{start}
+	for len(queue) > 0 {
+		name := queue[0]
+		queue = queue[1:]
+		for _, next := range graph[name] {
+			if !members[next] {
+				continue
+			}
+			if next == start {
+				cycle := []string{start}
+				for at := name; at != start; at = from[at] {
+					cycle = append([]string{at}, cycle...)
+				}
+				return append([]string{start}, cycle...)
+			}
+			if _, seen := from[next]; !seen {
+				from[next] = name
+				queue = append(queue, next)
+			}
+		}
+	}
+	return []string{start}
+}
+
+func contains(names []string, name string) bool {
+	for _, n := range names {
+		if n == name {
+			return true
+		}
+	}
+	return false
+}
+
+// Analysis is the nullable, FIRST and FOLLOW analysis of the rules of a grammar. The FIRST set of
+// a rule has the chars its matches may start with, after the leading insignificant chars, and
+// the literals they may start with. The FOLLOW set of a rule has the chars that may follow its
+// matches, and EOF if a match may end the input. Both are supersets, the lookaheads and the
+// excludes are not taken into account.
+type Analysis struct {
+	grammar   *Grammar
+	nullables map[string]bool
+	first     map[string]*CharSet
+	follow    map[string]*CharSet
+	dispatch  map[*ChoiceRule]*choiceDispatch // dispatch tables of the choices
+}
+
+// Analysis returns the analysis of the rules. It's cached until the rules, the start rule or the
+// case sensitivity change.
+func (inst *Grammar) Analysis() *Analysis {
+	if inst.analysis == nil {
+		inst.analysis = inst.analyze()
+	}
+	return inst.analysis
+}
+
+// Nullable checks whether the rule can match without using any char
+func (inst *Analysis) Nullable(ruleName string) bool {
+	return inst.nullables[ruleName]
+}
+
+// First returns the FIRST set of the rule, nil if the rule is not defined
+func (inst *Analysis) First(ruleName string) *CharSet {
+	return inst.first[ruleName]
+}
+
+// Follow returns the FOLLOW set of the rule, nil if the rule is not defined
+func (inst *Analysis) Follow(ruleName string) *CharSet {
+	return inst.follow[ruleName]
+}
+
+// FirstOf returns the FIRST set of any rule, such as an alternative of a choice
+func (inst *Analysis) FirstOf(rule IRule) *CharSet {
+	set := &CharSet{}
+	inst.addFirst(set, rule)
+	return set
+}
+
+// NullableOf checks whether any rule can match without using any char
+func (inst *Analysis) NullableOf(rule IRule) bool {
+	return nullable(rule, inst.nullables)
+}
+
+func (inst *Grammar) analyze() *Analysis {
+	analysis := &Analysis{
+		grammar:   inst,
+		nullables: inst.nullableRules(),
+		first:     make(map[string]*CharSet),
+		follow:    make(map[string]*CharSet),
+	}
+	for name := range inst.ruleRecords {
+		analysis.first[name] = &CharSet{}
+		analysis.follow[name] = &CharSet{}
+	}
+	for changed := true; changed; {
+		changed = false
+		for name, record := range inst.ruleRecords {
+			if analysis.first[name].union(analysis.FirstOf(record.rule)) {
+				changed = true
+			}
+		}
+	}
+	// the top rules are followed by the end of the input
+	for _, name := range inst.analysisTops() {
+		analysis.follow[name].EOF = true
+	}
+	for changed := true; changed; {
+		changed = false
+		for name, record := range inst.ruleRecords {
+			if analysis.addFollow(record.rule, analysis.follow[name]) {
+				changed = true
+			}
+		}
+	}
+	analysis.dispatch = analysis.dispatchTables()
+	return analysis
+}
+
+// analysisTops returns the rules evaluated at the top level, the same as the top rules, but
+// found even if the grammar is not validated yet.
+func (inst *Grammar) analysisTops() []string {
+	if inst.startRule != "" {
+		return []string{inst.startRule}
+	}
+	var names []string
+	for name, record := range inst.ruleRecords {
+		if _, exists := inst.nonRoots[name]; !exists && name != inst.skipRule && !record.imported {
+			names = append(names, name)
+		}
+	}
+	return names
+}
+
+// addFirst adds the FIRST set of the rule to the set
+func (inst *Analysis) addFirst(set *CharSet, rule IRule) {
+	fold := inst.grammar.ignoreCase
+	switch r := rule.(type) {
+	case *TerminalStringRule:
+		set.addLiteral(r.text, fold || r.caseInsensitive)
+	case *TerminalCharsRule:
+		set.addLiteral(r.text, fold || r.caseInsensitive)
+	case *TerminalCharRule:
+		set.addLiteral([]rune{r.text}, fold || r.caseInsensitive)
+	case *TerminalRangeRule:
+		set.addRange(r.begin, r.end)
+	case *TerminalClassRule:
+		set.addTable(r.table, r.negated)
+	case *TerminalSetRule:
+		items := &CharSet{}
+		for _, item := range r.items {
+			if item.class != nil {
+				items.addTable(item.class.table, item.class.negated)
+			} else {
+				items.addRange(item.begin, item.end)
+			}
+		}
+		if r.negated {
+			items = items.complement()
+		}
+		set.union(items)
+	case *TerminalAnyRule:
+		set.addRange(0, unicode.MaxRune)
+	case *EOFRule:
+		set.EOF = true
+	case *ReferenceRule:
+		set.union(inst.first[r.refName])
+	case *PredicateRule:
+		// a lookahead uses no char
+	case *DifferenceRule:
+		inst.addFirst(set, r.rule)
+	case *ConcatenateRule:
+		for _, child := range r.rules {
+			inst.addFirst(set, child)
+			if !nullable(child, inst.nullables) {
+				break
+			}
+		}
+	case *BlockRule:
+		inst.addFirst(set, r.open)
+		if nullable(r.open, inst.nullables) {
+			set.addRange(0, unicode.MaxRune) // any char of the content
+			set.EOF = set.EOF || r.virtualClose
+		}
+	default: // group, option, repetition and choice
+		for _, sub := range subRules(rule) {
+			inst.addFirst(set, sub)
+		}
+	}
+}
+
+// addFollow adds the FOLLOW sets of the rules referenced by the rule, which is followed by the
+// after set. Returns true if any FOLLOW set is changed.
+func (inst *Analysis) addFollow(rule IRule, after *CharSet) bool {
+	changed := false
+	switch r := rule.(type) {
+	case *ReferenceRule:
+		if follow := inst.follow[r.refName]; follow != nil {
+			changed = follow.union(after)
+		}
+	case *ConcatenateRule:
+		next := after
+		for i := len(r.rules) - 1; i >= 0; i-- {
+			child := r.rules[i]
+			if inst.addFollow(child, next) {
+				changed = true
+			}
+			first := inst.FirstOf(child)
+			if nullable(child, inst.nullables) {
+				first.union(next)
+			}
+			next = first
+		}
+	case *RepetitionRule:
+		// a match may be followed by another one
+		next := inst.FirstOf(r.rule)
+		next.union(after)
+		changed = inst.addFollow(r.rule, next)
+	case *BlockRule:
+		// the content may follow the open, escape and excludes, and contain any char
+		content := &CharSet{}
+		content.addRange(0, unicode.MaxRune)
+		content.union(inst.FirstOf(r.close))
+		for _, sub := range subRules(r) {
+			next := content
+			if sub == r.close {
+				next = after
+			}
+			if inst.addFollow(sub, next) {
+				changed = true
+			}
+		}
+	default: // group, option, predicate, difference and choice
+		for _, sub := range subRules(rule) {
+			if inst.addFollow(sub, after) {
+				changed = true
+			}
+		}
+	}
+	return changed
+}
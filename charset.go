@@ -0,0 +1,226 @@
+package xbnf
+
+import (
+	"fmt"
+	"sort"
+	"strings"
+	"unicode"
+)
+
+// CharRange is a range of chars from Lo to Hi, both inclusive
+type CharRange struct {
+	Lo rune
+	Hi rune
+}
+
+// CharSet is a set of chars, such as the chars a rule may start with. It also keeps the literals
+// starting with the chars, and whether the end of the input is in the set.
+type CharSet struct {
+	Ranges   []CharRange // sorted and disjoint
+	Literals []string    // sorted
+	EOF      bool
+}
+
+// Contains checks whether a char is in the set
+func (inst *CharSet) Contains(char rune) bool {
+	if inst == nil {
+		return false
+	}
+	if char == EOFChar {
+		return inst.EOF
+	}
+	i := sort.Search(len(inst.Ranges), func(i int) bool {
+		return inst.Ranges[i].Hi >= char
+	})
+	return i < len(inst.Ranges) && inst.Ranges[i].Lo <= char
+}
+
+// IsEmpty checks whether the set has no char and no EOF
+func (inst *CharSet) IsEmpty() bool {
+	return inst == nil || (len(inst.Ranges) == 0 && !inst.EOF)
+}
+
+// Intersects checks whether the 2 sets have a char or the EOF in common
+func (inst *CharSet) Intersects(other *CharSet) bool {
+	if inst == nil || other == nil {
+		return false
+	}
+	if inst.EOF && other.EOF {
+		return true
+	}
+	i, j := 0, 0
+	for i < len(inst.Ranges) && j < len(other.Ranges) {
+		a, b := inst.Ranges[i], other.Ranges[j]
+		if a.Hi < b.Lo {
+			i++
+		} else if b.Hi < a.Lo {
+			j++
+		} else {
+			return true
+		}
+	}
+	return false
+}
+
+func (inst *CharSet) addRange(lo, hi rune) {
+	inst.Ranges = append(inst.Ranges, CharRange{lo, hi})
+	inst.normalize()
+}
+
+// addChar adds a char, and the other cases of it if fold is true
+func (inst *CharSet) addChar(char rune, fold bool) {
+	inst.Ranges = append(inst.Ranges, CharRange{char, char})
+	if fold {
+		for other := unicode.SimpleFold(char); other != char; other = unicode.SimpleFold(other) {
+			inst.Ranges = append(inst.Ranges, CharRange{other, other})
+		}
+	}
+	inst.normalize()
+}
+
+// addLiteral adds a literal and its first char
+func (inst *CharSet) addLiteral(text []rune, fold bool) {
+	if len(text) == 0 {
+		return
+	}
+	inst.addChar(text[0], fold)
+	literal := string(text)
+	i := sort.SearchStrings(inst.Literals, literal)
+	if i < len(inst.Literals) && inst.Literals[i] == literal {
+		return
+	}
+	inst.Literals = append(inst.Literals, "")
+	copy(inst.Literals[i+1:], inst.Literals[i:])
+	inst.Literals[i] = literal
+}
+
+// addTable adds the chars of an unicode table, or the chars not in it if negated
+func (inst *CharSet) addTable(table *unicode.RangeTable, negated bool) {
+	set := &CharSet{}
+	for _, r := range table.R16 {
+		set.addStride(rune(r.Lo), rune(r.Hi), rune(r.Stride))
+	}
+	for _, r := range table.R32 {
+		set.addStride(rune(r.Lo), rune(r.Hi), rune(r.Stride))
+	}
+	set.normalize()
+	if negated {
+		set = set.complement()
+	}
+	inst.union(set)
+}
+
+func (inst *CharSet) addStride(lo, hi, stride rune) {
+	if stride == 1 {
+		inst.Ranges = append(inst.Ranges, CharRange{lo, hi})
+		return
+	}
+	for char := lo; char <= hi; char += stride {
+		inst.Ranges = append(inst.Ranges, CharRange{char, char})
+	}
+}
+
+// complement returns the chars not in the set, the literals and EOF are dropped
+func (inst *CharSet) complement() *CharSet {
+	result := &CharSet{}
+	next := rune(0)
+	for _, r := range inst.Ranges {
+		if r.Lo > next {
+			result.Ranges = append(result.Ranges, CharRange{next, r.Lo - 1})
+		}
+		next = r.Hi + 1
+	}
+	if next <= unicode.MaxRune {
+		result.Ranges = append(result.Ranges, CharRange{next, unicode.MaxRune})
+	}
+	return result
+}
+
+// union adds all chars, literals and EOF of the other set, returns true if the set is changed
+func (inst *CharSet) union(other *CharSet) bool {
+	if other == nil {
+		return false
+	}
+	changed := false
+	if other.EOF && !inst.EOF {
+		inst.EOF = true
+		changed = true
+	}
+	if len(other.Ranges) > 0 {
+		before := len(inst.Ranges)
+		var size rune
+		for _, r := range inst.Ranges {
+			size += r.Hi - r.Lo + 1
+		}
+		inst.Ranges = append(inst.Ranges, other.Ranges...)
+		inst.normalize()
+		var after rune
+		for _, r := range inst.Ranges {
+			after += r.Hi - r.Lo + 1
+		}
+		if after != size || len(inst.Ranges) != before {
+			changed = true
+		}
+	}
+	for _, literal := range other.Literals {
+		i := sort.SearchStrings(inst.Literals, literal)
+		if i < len(inst.Literals) && inst.Literals[i] == literal {
+			continue
+		}
+		inst.Literals = append(inst.Literals, "")
+		copy(inst.Literals[i+1:], inst.Literals[i:])
+		inst.Literals[i] = literal
+		changed = true
+	}
+	return changed
+}
+
+// normalize sorts the ranges and merges the overlapping or adjacent ones
+func (inst *CharSet) normalize() {
+	if len(inst.Ranges) < 2 {
+		return
+	}
+	sort.Slice(inst.Ranges, func(i, j int) bool {
+		return inst.Ranges[i].Lo < inst.Ranges[j].Lo
+	})
+	merged := inst.Ranges[:1]
+	for _, r := range inst.Ranges[1:] {
+		last := &merged[len(merged)-1]
+		if r.Lo <= last.Hi+1 {
+			if r.Hi > last.Hi {
+				last.Hi = r.Hi
+			}
+			continue
+		}
+		merged = append(merged, r)
+	}
+	inst.Ranges = merged
+}
+
+// String returns the set like `\[a-z"] "true" EOF`, the chars are written as a char set of
+// xbnf, or `.` if it has all chars.
+func (inst *CharSet) String() string {
+	if inst == nil {
+		return ""
+	}
+	var items []string
+	if len(inst.Ranges) == 1 && inst.Ranges[0] == (CharRange{0, unicode.MaxRune}) {
+		items = append(items, string(AnyCharSymbol))
+	} else if len(inst.Ranges) > 0 {
+		var buf strings.Builder
+		buf.WriteRune(EscapeSymbol)
+		buf.WriteRune(SetOpenSymbol)
+		for _, r := range inst.Ranges {
+			buf.WriteString((&setItem{begin: r.Lo, end: r.Hi}).String())
+		}
+		buf.WriteRune(SetCloseSymbol)
+		items = append(items, buf.String())
+	}
+	for _, literal := range inst.Literals {
+		items = append(items, fmt.Sprintf("%q", literal))
+	}
+	if inst.EOF {
+		items = append(items, string(TypeEOF))
+	}
+	return strings.Join(items, " ")
+}
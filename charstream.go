@@ -53,6 +53,15 @@ type ICharstream interface {
 	PositionLookup(idx int) *Position
 
 	Cursor() int // return current cursor which is the 0-base index position in the stream.
+
+	// Seek moves the cursor to an index in the stream, so the chars from the index will be read
+	// again. This is how rules rewind the stream when backtracking. Seeking forward beyond the
+	// chars read reads the chars in between.
+	Seek(cursor int)
+
+	// Release tells the stream that the chars before the cursor will never be read again, so
+	// the stream can free them. Seeking to an index before a released cursor is not allowed.
+	Release(cursor int)
 }
 
 type positionMap struct {
@@ -137,136 +146,6 @@ func (inst *positionMap) lookup(idx int) *Position {
 	return &Position{Line: lineIdx + 1, Col: col}
 }
 
-/*
-*
-
-	func NewCharstreamFromFile(file string) (ICharstream, error) {
-		reader, err := os.Open(file)
-		if err != nil {
-			return nil, err
-		}
-		runeReader := bufio.NewReader(reader)
-		cs := &CharstreamFile{}
-		cs.source = File(file)
-		cs.runeReader = runeReader
-		return cs
-	}
-
-	type CharstreamFile struct {
-		lock       sync.RWMutex
-		lines      []uint64    // array of lines, the value is last char 0-base index in the line, the newline \n char is not included in any line
-		source     interface{} // could be File/String
-		runeReader *bufio.Reader
-		cursor     uint64
-	}
-
-	func (inst *CharstreamFile) Position() Position {
-		inst.lock.Lock()
-		defer inst.lock.Unlock()
-
-		return inst.position
-	}
-
-	func (inst *CharstreamFile) Index() int {
-		inst.lock.Lock()
-		defer inst.lock.Unlock()
-
-		return inst.cursor
-	}
-
-	func (inst *CharstreamFile) Next() rune {
-		inst.lock.Lock()
-		defer inst.lock.Unlock()
-
-		return inst.next()
-	}
-
-	func (inst *CharstreamFile) next() rune {
-		if len(inst.chars) == 0 {
-			return EOFChar
-		}
-		if inst.cursor >= len(inst.chars) {
-			return EOFChar
-		}
-		idx := inst.cursor
-		inst.cursor = inst.cursor + 1
-		char := inst.chars[idx]
-		if char == '\n' {
-			inst.position.Line = inst.position.Line + 1
-		} else {
-			inst.position.Col = inst.position.Col + 1
-		}
-		return char
-	}
-
-	func (inst *CharstreamFile) Peek() rune {
-		inst.lock.Lock()
-		defer inst.lock.Unlock()
-
-		if len(inst.chars) == 0 {
-			return EOFChar
-		}
-		if inst.cursor >= len(inst.chars) {
-			return EOFChar
-		}
-		return inst.chars[inst.cursor]
-	}
-
-// Read all chars from the stream until a none-whitespace character. Return nil slice if the
-// current char is a none-whitespace
-
-	func (inst *CharstreamFile) SkipSpaces() []rune {
-		inst.lock.Lock()
-		defer inst.lock.Unlock()
-
-		beginCur := inst.cursor
-		i := inst.cursor
-		countNewline := uint(0)
-		lastNewline := 0
-		for i = inst.cursor; i < len(inst.chars); i++ {
-			if !IsWhiteSpace(inst.chars[i]) {
-				break
-			}
-			if inst.chars[i] == '\n' {
-				countNewline++
-				lastNewline = i
-			}
-		}
-		if i > beginCur {
-			inst.cursor = i
-			spaces := inst.chars[beginCur:inst.cursor]
-			if countNewline > 0 {
-				inst.position.Line = inst.position.Line + countNewline
-				inst.position.Col = uint(inst.cursor - lastNewline)
-			} else {
-				inst.position.Col = inst.position.Col + uint(len(spaces))
-			}
-			return spaces
-		}
-		return nil
-	}
-
-	func (inst *CharstreamFile) Match(input []rune) ([]rune, bool) {
-		inst.lock.Lock()
-		defer inst.lock.Unlock()
-
-		if input == nil || len(input) == 0 {
-			return nil, true
-		}
-		var result []rune
-		for _, inputChar := range input {
-			char := inst.next()
-			if char == EOFChar {
-				return result, false // not match
-			}
-			result = append(result, char)
-			if char != inputChar {
-				return result, false
-			}
-		}
-		return result, true
-	}
-*/
 type File string
 type String string
 
@@ -328,6 +207,26 @@ func (inst *CharstreamString) Cursor() int {
 	return inst.cursor
 }
 
+func (inst *CharstreamString) Seek(cursor int) {
+	inst.lock.Lock()
+	defer inst.lock.Unlock()
+
+	if cursor < 0 {
+		cursor = 0
+	}
+	if cursor > len(inst.chars) {
+		cursor = len(inst.chars)
+	}
+	if cursor > inst.cursor {
+		inst.positionMap.update(inst.cursor, inst.chars[inst.cursor:cursor]...)
+	}
+	inst.cursor = cursor
+}
+
+// Release does nothing, the whole string is always in memory
+func (inst *CharstreamString) Release(cursor int) {
+}
+
 func (inst *CharstreamString) Next() rune {
 	inst.lock.Lock()
 	defer inst.lock.Unlock()
@@ -412,115 +311,3 @@ func (inst *CharstreamString) Match(input []rune) ([]rune, bool) {
 
 	return result, true
 }
-
-// The prepend MUST be chars read just before the cursor.
-func newCharstreamPrepend(baseCharstream ICharstream, prepend []rune) ICharstream {
-	if len(prepend) == 0 {
-		return baseCharstream
-	}
-
-	csp := &CharstreamPrepend{}
-	csp.charstream = baseCharstream
-	if csp.charstream == nil {
-		csp.charstream = NewCharstreamFromString("")
-	}
-	csp.prepend = prepend
-	return csp
-}
-
-// CharstreamPrepend is thread-safe
-type CharstreamPrepend struct {
-	prepend    []rune
-	charstream ICharstream
-	cursor     int // this cursor is up to only len(prepend)
-	lock       sync.RWMutex
-}
-
-func (inst *CharstreamPrepend) Next() rune {
-	inst.lock.Lock()
-	defer inst.lock.Unlock()
-
-	return inst.next()
-}
-
-func (inst *CharstreamPrepend) next() rune {
-	if inst.prepend != nil && inst.cursor < len(inst.prepend) {
-		inst.cursor = inst.cursor + 1
-		return inst.prepend[inst.cursor-1]
-	}
-	return inst.charstream.Next()
-}
-
-func (inst *CharstreamPrepend) Peek() rune {
-	inst.lock.RLock()
-	defer inst.lock.RUnlock()
-	if inst.prepend != nil && inst.cursor < len(inst.prepend) {
-		return inst.prepend[inst.cursor]
-	}
-	return inst.charstream.Peek()
-}
-
-func (inst *CharstreamPrepend) peek() rune {
-	if inst.prepend != nil && inst.cursor < len(inst.prepend) {
-		return inst.prepend[inst.cursor]
-	}
-	return inst.charstream.Peek()
-}
-
-func (inst *CharstreamPrepend) SkipSpaces() []rune {
-	inst.lock.Lock()
-	defer inst.lock.Unlock()
-
-	var charsRead []rune
-	for {
-		char := inst.peek()
-		if char == EOFChar {
-			break
-		}
-		if !IsWhiteSpace(char) {
-			break
-		}
-		charsRead = append(charsRead, inst.next())
-	}
-	return charsRead
-}
-
-func (inst *CharstreamPrepend) Match(input []rune) ([]rune, bool) {
-	inst.lock.Lock()
-	defer inst.lock.Unlock()
-	if input == nil || len(input) == 0 {
-		return nil, true
-	}
-	var result []rune
-	for _, inputChar := range input {
-		char := inst.next()
-		if char == EOFChar {
-			return result, false // not match
-		}
-		result = append(result, char)
-		if char != inputChar {
-			return result, false
-		}
-	}
-	return result, true
-}
-
-func (inst *CharstreamPrepend) Position() *Position {
-	if inst.cursor >= len(inst.prepend) {
-		return inst.charstream.Position()
-	}
-	idx := inst.charstream.Cursor() - len(inst.prepend) + inst.cursor
-	return inst.charstream.PositionLookup(idx)
-}
-
-// Return the position of char index
-func (inst *CharstreamPrepend) PositionLookup(idx int) *Position {
-	return inst.charstream.PositionLookup(idx)
-}
-
-func (inst *CharstreamPrepend) Cursor() int {
-	inst.lock.RLock()
-	defer inst.lock.RUnlock()
-
-	return inst.charstream.Cursor() - len(inst.prepend) + inst.cursor
-}
@@ -0,0 +1,289 @@
+package xbnf
+
+import (
+	"bufio"
+	"fmt"
+	"io"
+	"os"
+	"sort"
+	"sync"
+)
+
+// DefaultCharstreamWindow is the number of chars a CharstreamReader keeps behind its released
+// cursor so that positions and lines of recently read chars can still be looked up.
+const DefaultCharstreamWindow = 4096
+
+// NewCharstreamFromReader creates a charstream that decodes UTF-8 chars from the reader
+// lazily, ie. a char is read from the reader only when the stream needs it. Only the chars
+// that may still be read again, ie. the chars after the released cursor, and a window of chars
+// before it are kept in memory, so the stream can be used to parse inputs that are too large
+// to be loaded as a whole.
+func NewCharstreamFromReader(reader io.Reader) *CharstreamReader {
+	cs := &CharstreamReader{}
+	runeReader, ok := reader.(io.RuneReader)
+	if !ok {
+		runeReader = bufio.NewReader(reader)
+	}
+	cs.reader = runeReader
+	cs.window = DefaultCharstreamWindow
+	cs.line = 1
+	cs.col = 1
+	return cs
+}
+
+// NewCharstreamFromFile creates a CharstreamReader reading from a file. The caller should
+// Close() the returned stream when it's no longer needed.
+func NewCharstreamFromFile(file string) (*CharstreamReader, error) {
+	reader, err := os.Open(file)
+	if err != nil {
+		return nil, err
+	}
+	cs := NewCharstreamFromReader(bufio.NewReader(reader))
+	cs.closer = reader
+	cs.source = File(file)
+	return cs, nil
+}
+
+// CharstreamReader is thread-safe
+type CharstreamReader struct {
+	reader   io.RuneReader
+	closer   io.Closer
+	source   interface{} // could be File or nil
+	window   int         // max # of chars kept behind the released cursor
+	chars    []rune      // buffered chars, chars[0] is the char at index offset in the stream
+	offset   int         // stream index of chars[0]
+	line     int         // line of chars[0]
+	col      int         // col of chars[0]
+	newlines []int       // stream indexes of all '\n' chars in the buffer, in order
+	cursor   int         // cursor starts at 0
+	released int         // chars before this index will never be read again
+	eof      bool        // the underlying reader has no more chars
+	err      error       // the read error other than io.EOF, if any
+	lock     sync.RWMutex
+}
+
+// SetWindow changes the number of chars kept behind the released cursor. A size less than 1 is
+// ignored.
+func (inst *CharstreamReader) SetWindow(size int) {
+	inst.lock.Lock()
+	defer inst.lock.Unlock()
+
+	if size > 0 {
+		inst.window = size
+	}
+}
+
+// Err returns the first error, other than io.EOF, encountered by reading the underlying
+// reader. The stream reports EOF when such an error occurs.
+func (inst *CharstreamReader) Err() error {
+	inst.lock.RLock()
+	defer inst.lock.RUnlock()
+
+	return inst.err
+}
+
+// Close closes the underlying file if the stream is created by NewCharstreamFromFile
+func (inst *CharstreamReader) Close() error {
+	inst.lock.Lock()
+	defer inst.lock.Unlock()
+
+	if inst.closer == nil {
+		return nil
+	}
+	err := inst.closer.Close()
+	inst.closer = nil
+	return err
+}
+
+// fill reads chars from the reader until the char at idx is buffered or the reader has no
+// more chars. Return false if the char at idx is not available.
+func (inst *CharstreamReader) fill(idx int) bool {
+	for inst.offset+len(inst.chars) <= idx {
+		if inst.eof {
+			return false
+		}
+		char, _, err := inst.reader.ReadRune()
+		if err != nil {
+			inst.eof = true
+			if err != io.EOF {
+				inst.err = err
+			}
+			return false
+		}
+		if char == '\n' {
+			inst.newlines = append(inst.newlines, inst.offset+len(inst.chars))
+		}
+		inst.chars = append(inst.chars, char)
+	}
+	return true
+}
+
+// trim drops the chars that are more than a window behind the released cursor. The chars are
+// dropped in batches so the buffer is not copied on every release.
+func (inst *CharstreamReader) trim() {
+	drop := inst.released - inst.window - inst.offset
+	if drop < inst.window {
+		return
+	}
+	newOffset := inst.offset + drop
+	countNewlines := sort.SearchInts(inst.newlines, newOffset) // newlines dropped
+	if countNewlines > 0 {
+		lastNewline := inst.newlines[countNewlines-1]
+		inst.line = inst.line + countNewlines
+		inst.col = newOffset - lastNewline
+	} else {
+		inst.col = inst.col + drop
+	}
+	inst.newlines = append([]int(nil), inst.newlines[countNewlines:]...)
+	inst.chars = append([]rune(nil), inst.chars[drop:]...)
+	inst.offset = newOffset
+}
+
+// lookup translates a buffered index to a position, no locking
+func (inst *CharstreamReader) lookup(idx int) *Position {
+	if idx < inst.offset || idx >= inst.offset+len(inst.chars) {
+		return nil
+	}
+	countNewlines := sort.SearchInts(inst.newlines, idx) // newlines before idx
+	if countNewlines == 0 {
+		return &Position{Line: inst.line, Col: inst.col + idx - inst.offset}
+	}
+	return &Position{Line: inst.line + countNewlines, Col: idx - inst.newlines[countNewlines-1]}
+}
+
+func (inst *CharstreamReader) Position() *Position {
+	inst.lock.Lock()
+	defer inst.lock.Unlock()
+
+	if !inst.fill(inst.cursor) {
+		// cursor is at EOF
+		return nil
+	}
+	return inst.lookup(inst.cursor)
+}
+
+// Return the position of char index. Return nil if the char at the index is not read yet or
+// is already out of the window
+func (inst *CharstreamReader) PositionLookup(idx int) *Position {
+	inst.lock.RLock()
+	defer inst.lock.RUnlock()
+
+	if idx == 0 {
+		return &Position{Line: 1, Col: 1}
+	}
+	if idx < 0 || idx >= inst.cursor {
+		return nil
+	}
+	return inst.lookup(idx)
+}
+
+func (inst *CharstreamReader) Cursor() int {
+	inst.lock.RLock()
+	defer inst.lock.RUnlock()
+
+	return inst.cursor
+}
+
+// Seek moves the cursor to the index. If the index is out of the chars kept in memory, the
+// cursor is moved to the first char kept, and an error is reported by Err()
+func (inst *CharstreamReader) Seek(cursor int) {
+	inst.lock.Lock()
+	defer inst.lock.Unlock()
+
+	if cursor < inst.offset {
+		if inst.err == nil {
+			inst.err = fmt.Errorf("seek to index %d: chars before index %d are released", cursor, inst.offset)
+		}
+		cursor = inst.offset
+	}
+	if cursor > inst.cursor && !inst.fill(cursor-1) {
+		cursor = inst.offset + len(inst.chars) // EOF
+	}
+	inst.cursor = cursor
+}
+
+// Release allows the stream to free the chars that are more than a window before the cursor.
+func (inst *CharstreamReader) Release(cursor int) {
+	inst.lock.Lock()
+	defer inst.lock.Unlock()
+
+	if cursor > inst.cursor {
+		cursor = inst.cursor
+	}
+	if cursor > inst.released {
+		inst.released = cursor
+		inst.trim()
+	}
+}
+
+func (inst *CharstreamReader) Next() rune {
+	inst.lock.Lock()
+	defer inst.lock.Unlock()
+
+	return inst.next()
+}
+
+// internal next, no locking, the caller need to make sure the inst is lock
+func (inst *CharstreamReader) next() rune {
+	if !inst.fill(inst.cursor) {
+		return EOFChar
+	}
+	char := inst.chars[inst.cursor-inst.offset]
+	inst.cursor = inst.cursor + 1
+	return char
+}
+
+// internal peek, no locking, the caller need to make sure the inst is lock
+func (inst *CharstreamReader) peek() rune {
+	if !inst.fill(inst.cursor) {
+		return EOFChar
+	}
+	return inst.chars[inst.cursor-inst.offset]
+}
+
+func (inst *CharstreamReader) Peek() rune {
+	inst.lock.Lock()
+	defer inst.lock.Unlock()
+
+	return inst.peek()
+}
+
+// Read all chars from the stream until a none-whitespace character. Return nil slice if the
+// current char is a none-whitespace
+func (inst *CharstreamReader) SkipSpaces() []rune {
+	inst.lock.Lock()
+	defer inst.lock.Unlock()
+
+	var spaces []rune
+	for {
+		char := inst.peek()
+		if char == EOFChar || !IsWhiteSpace(char) {
+			break
+		}
+		spaces = append(spaces, inst.next())
+	}
+	return spaces
+}
+
+// Matches the input rune slice, if succeeded, return the match rune list. If not,
+// return false and the slice of rune read in order to try the match
+func (inst *CharstreamReader) Match(input []rune) ([]rune, bool) {
+	inst.lock.Lock()
+	defer inst.lock.Unlock()
+
+	if len(input) == 0 {
+		return nil, true
+	}
+	var result []rune
+	for _, inputChar := range input {
+		char := inst.next()
+		if char == EOFChar {
+			return result, false // not match
+		}
+		result = append(result, char)
+		if char != inputChar {
+			return result, false
+		}
+	}
+	return result, true
+}
@@ -1,6 +1,7 @@
 package xbnf
 
 import (
+	"strings"
 	"testing"
 )
 
@@ -22,14 +23,12 @@ func TestCharstreamNextString(t *testing.T) {
 	t.Logf("Passed: read %d char(s), all matched expectation", idx)
 }
 
-func TestCharstreamNextPrepend(t *testing.T) {
-	css, charSequence, _ := getCharStream()
-	var prepend []rune
+func TestCharstreamNextSeek(t *testing.T) {
+	cs, charSequence, _ := getCharStream()
 	for i := 0; i < len(charSequence)/2; i++ {
-		char := css.Next()
-		prepend = append(prepend, char)
+		cs.Next()
 	}
-	cs := newCharstreamPrepend(css, prepend)
+	cs.Seek(0) // read the chars again from the beginning
 	t.Logf("ICharStream type: %T", cs)
 	var idx int
 	for idx = 0; ; idx++ {
@@ -81,9 +80,15 @@ func TestCharstreamMatch(t *testing.T) {
 	}
 	tester(NewCharstreamFromString("This is my name 'Kevin Xie'"), "This is m")
 	tester(NewCharstreamFromString("This is my name 'Kevin Xie'"), "This Is m")
-	tester(newCharstreamPrepend(NewCharstreamFromString("This is my name 'Kevin Xie'"), []rune("Prepend Text: ")), "Prepend Tex")
-	tester(newCharstreamPrepend(NewCharstreamFromString("This is my name 'Kevin Xie'"), []rune("Prepend Text: ")), "Prepend Text: This ")
-	tester(newCharstreamPrepend(NewCharstreamFromString("This is my name 'Kevin Xie'"), []rune("Prepend Text: ")), "Prepend Text: This M")
+	seeked := func(example string, cursor int) ICharstream {
+		cs := NewCharstreamFromString(example)
+		cs.Match([]rune(example))
+		cs.Seek(cursor)
+		return cs
+	}
+	tester(seeked("This is my name 'Kevin Xie'", 0), "This is m")
+	tester(seeked("This is my name 'Kevin Xie'", 5), "is my")
+	tester(seeked("This is my name 'Kevin Xie'", 5), "is My")
 }
 
 func TestCharstreamPositionString(t *testing.T) {
@@ -121,14 +126,12 @@ func TestCharstreamPositionString(t *testing.T) {
 	t.Logf("Passed: every char read matched char get by position")
 }
 
-func TestCharstreamPositionPrepend(t *testing.T) {
-	css, charSequence, charMap := getCharStream()
-	var prepend []rune
+func TestCharstreamPositionSeek(t *testing.T) {
+	cs, charSequence, charMap := getCharStream()
 	for i := 0; i < len(charSequence)/2; i++ {
-		char := css.Next()
-		prepend = append(prepend, char)
+		cs.Next()
 	}
-	cs := newCharstreamPrepend(css, prepend)
+	cs.Seek(0) // read the chars again from the beginning
 	t.Logf("ICharStream type: %T", cs)
 	var pos *Position
 	var charRead rune
@@ -207,14 +210,12 @@ func TestCharstreamLookupString(t *testing.T) {
 	tester(t, 1000)
 }
 
-func TestCharstreamLookupPrepend(t *testing.T) {
-	css, charSequence, charMap := getCharStream()
-	var prepend []rune
+func TestCharstreamLookupSeek(t *testing.T) {
+	cs, charSequence, charMap := getCharStream()
 	for i := 0; i < len(charSequence)/2; i++ {
-		char := css.Next()
-		prepend = append(prepend, char)
+		cs.Next()
 	}
-	cs := newCharstreamPrepend(css, prepend)
+	cs.Seek(0) // read the chars again from the beginning
 	for cs.Next() != EOFChar {
 	}
 	t.Logf("ICharStream type: %T", cs)
@@ -284,3 +285,160 @@ func getCharStream() (cs ICharstream, charSequence []rune, charMap [][]rune) {
 	cs = NewCharstreamFromString(string(charSequence))
 	return
 }
+
+func getCharStreamReader(window int) (cs *CharstreamReader, charSequence []rune, charMap [][]rune) {
+	_, charSequence, charMap = getCharStream()
+	cs = NewCharstreamFromReader(strings.NewReader(string(charSequence)))
+	cs.SetWindow(window)
+	return
+}
+
+func TestCharstreamNextReader(t *testing.T) {
+	cs, charSequence, _ := getCharStreamReader(4)
+	var idx int
+	t.Logf("ICharStream type: %T", cs)
+	for idx = 0; ; idx++ {
+		char := cs.Next()
+		if char == EOFChar {
+			break
+		}
+		expectChar := charSequence[idx]
+		if expectChar != char {
+			t.Errorf("Failed: At %d index: expect '%c' vs actual '%c'", idx, expectChar, char)
+			return
+		}
+	}
+	if idx != len(charSequence) {
+		t.Errorf("Failed: read %d char(s), expect %d", idx, len(charSequence))
+		return
+	}
+	t.Logf("Passed: read %d char(s), all matched expectation", idx)
+}
+
+func TestCharstreamPositionReader(t *testing.T) {
+	cs, charSequence, charMap := getCharStreamReader(4)
+	t.Logf("ICharStream type: %T", cs)
+	var pos *Position
+	var charRead rune
+	var charAtPos rune
+	// before reading anything
+	pos = cs.Position()
+	if pos == nil && len(charSequence) != 0 {
+		t.Errorf("Failed: expect L1:1 but get %s", pos.String())
+		return
+	}
+	for {
+		charRead = cs.Next()
+		if charRead == EOFChar {
+			break
+		}
+		charAtPos = charMap[pos.Line-1][pos.Col-1]
+		if charAtPos != charRead {
+			t.Errorf("Failed: char read is %q vs char at %s is %q", charRead, pos.String(), charAtPos)
+			return
+		}
+		pos = cs.Position()
+	}
+	if pos != nil {
+		t.Errorf("Failed: expect nil position at EOF, but got %s", pos.String())
+		return
+	}
+	t.Logf("Passed: every char read matched char get by position")
+}
+
+func TestCharstreamLookupReader(t *testing.T) {
+	cs, charSequence, charMap := getCharStreamReader(DefaultCharstreamWindow)
+	for cs.Next() != EOFChar {
+	}
+	t.Logf("ICharStream type: %T", cs)
+	for idx := -1; idx <= len(charSequence); idx++ {
+		pos := cs.PositionLookup(idx)
+		if idx < 0 || idx >= len(charSequence) {
+			if pos != nil {
+				t.Errorf("Failed: %d index expects nil position, but got %s", idx, pos.String())
+				return
+			}
+			continue
+		}
+		if pos == nil {
+			t.Errorf("Failed: %d index expects a position, but got nil", idx)
+			return
+		}
+		if charSequence[idx] != charMap[pos.Line-1][pos.Col-1] {
+			t.Errorf("Failed: char at %d index is %q vs %q at position %s", idx, charSequence[idx],
+				charMap[pos.Line-1][pos.Col-1], pos.String())
+			return
+		}
+	}
+	t.Logf("Passed: every index lookup matched char in the sequence")
+}
+
+func TestCharstreamWindowReader(t *testing.T) {
+	window := 5
+	cs, charSequence, charMap := getCharStreamReader(window)
+	for i := 0; i < len(charSequence); i++ {
+		cs.Next()
+		cursor := cs.Cursor()
+		cs.Release(cursor)
+		// chars within the window behind the cursor must have correct positions
+		for idx := cursor - window; idx < cursor; idx++ {
+			if idx < 0 {
+				continue
+			}
+			pos := cs.PositionLookup(idx)
+			if pos == nil {
+				t.Errorf("Failed: %d index within window of cursor %d expects a position", idx, cursor)
+				return
+			}
+			if charSequence[idx] != charMap[pos.Line-1][pos.Col-1] {
+				t.Errorf("Failed: char at %d index is %q vs %q at position %s", idx, charSequence[idx],
+					charMap[pos.Line-1][pos.Col-1], pos.String())
+				return
+			}
+		}
+		if len(cs.chars) > 3*window+1 {
+			t.Errorf("Failed: %d chars buffered, window is %d", len(cs.chars), window)
+			return
+		}
+	}
+	if pos := cs.PositionLookup(1); pos != nil {
+		t.Errorf("Failed: index 1 is out of window, but got position %s", pos.String())
+		return
+	}
+	t.Logf("Passed: positions within window are correct, buffer stays bounded")
+}
+
+func TestCharstreamSeekReader(t *testing.T) {
+	window := 5
+	cs, charSequence, _ := getCharStreamReader(window)
+	for i := 0; i < 20; i++ {
+		cs.Next()
+	}
+	// nothing is released yet, all chars read can be read again
+	cs.Seek(0)
+	for idx := 0; idx < 20; idx++ {
+		if char := cs.Next(); char != charSequence[idx] {
+			t.Errorf("Failed: At %d index: expect %q vs actual %q", idx, charSequence[idx], char)
+			return
+		}
+	}
+	// seek forward reads the chars not read yet
+	cs.Seek(30)
+	if char := cs.Next(); char != charSequence[30] {
+		t.Errorf("Failed: At 30 index: expect %q vs actual %q", charSequence[30], char)
+		return
+	}
+	cs.Seek(len(charSequence) + 10)
+	if cs.Cursor() != len(charSequence) || cs.Peek() != EOFChar {
+		t.Errorf("Failed: seek beyond EOF, cursor is %d", cs.Cursor())
+		return
+	}
+	// chars released are dropped, seeking to them is an error
+	cs.Release(cs.Cursor())
+	cs.Seek(0)
+	if cs.Err() == nil {
+		t.Errorf("Failed: seek to a released char expects an error")
+		return
+	}
+	t.Logf("Passed: %s", cs.Err())
+}
@@ -0,0 +1,80 @@
+package xbnf
+
+import (
+	"fmt"
+	"strings"
+)
+
+// DirectiveSymbol starts a directive line in a grammar file, such as `@sync semicolon`
+const DirectiveSymbol = '@'
+
+// parseDirective applies a directive line to the grammar. Arguments of a directive are
+// separated by spaces or commas, a trailing comment is allowed.
+func (inst *Grammar) parseDirective(line string) error {
+	if idx := strings.Index(line, "//"); idx >= 0 {
+		line = line[:idx]
+	}
+	fields := strings.FieldsFunc(strings.TrimPrefix(line, string(DirectiveSymbol)), func(char rune) bool {
+		return IsWhiteSpace(char) || char == ','
+	})
+	if len(fields) == 0 {
+		return fmt.Errorf("missing directive name: %s", line)
+	}
+	directive, args := fields[0], fields[1:]
+	if inst.loading != nil && inst.loading.parent != nil && directive != "import" {
+		return nil // only imports apply in an imported file
+	}
+	switch directive {
+	case "import":
+		// @import "path" [as namespace]
+		if len(args) != 1 && !(len(args) == 3 && args[1] == "as") {
+			return fmt.Errorf("directive @%s: expect a file path and an optional 'as namespace'", directive)
+		}
+		var namespace string
+		if len(args) == 3 {
+			name, err := validateRuleName(args[2])
+			if err != nil {
+				return fmt.Errorf("directive @%s: namespace %s", directive, err)
+			}
+			namespace = name
+		}
+		return inst.importFile(strings.Trim(args[0], `"'`), namespace)
+	case "sync":
+		if len(args) == 0 {
+			return fmt.Errorf("directive @%s: missing rule name", directive)
+		}
+		for _, arg := range args {
+			name, err := validateRuleRef(arg)
+			if err != nil {
+				return fmt.Errorf("directive @%s: %s", directive, err)
+			}
+			inst.syncRules = append(inst.syncRules, name)
+		}
+	case "start":
+		if len(args) != 1 {
+			return fmt.Errorf("directive @%s: expect 1 rule name, got %d", directive, len(args))
+		}
+		name, err := validateRuleRef(args[0])
+		if err != nil {
+			return fmt.Errorf("directive @%s: %s", directive, err)
+		}
+		inst.startRule = name
+	case "skip":
+		if len(args) != 1 {
+			return fmt.Errorf("directive @%s: expect 1 rule name, got %d", directive, len(args))
+		}
+		name, err := validateRuleRef(args[0])
+		if err != nil {
+			return fmt.Errorf("directive @%s: %s", directive, err)
+		}
+		inst.skipRule = name
+	case "ignorecase":
+		if len(args) != 0 {
+			return fmt.Errorf("directive @%s: unexpected argument %s", directive, args[0])
+		}
+		inst.ignoreCase = true
+	default:
+		return fmt.Errorf("unknown directive @%s", directive)
+	}
+	return nil
+}
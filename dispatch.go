@@ -0,0 +1,147 @@
+package xbnf
+
+// whiteSpaces are the chars IsWhiteSpace is true for
+var whiteSpaces = func() *CharSet {
+	set := &CharSet{}
+	for char := rune(0); char <= '\u3000'; char++ {
+		if IsWhiteSpace(char) {
+			set.Ranges = append(set.Ranges, CharRange{char, char})
+		}
+	}
+	set.normalize()
+	return set
+}()
+
+// choiceDispatch is the dispatch table of a choice, it tells which alternatives may match by the
+// next char, so the others are not evaluated. The alternatives of all groups are numbered in the
+// order they are written.
+type choiceDispatch struct {
+	firsts     []*CharSet   // FIRST set of each alternative
+	always     []bool       // alternatives evaluated whatever the next char is
+	failSticky []bool       // stickiness of each alternative failing at the next char
+	ascii      [128][]int   // alternatives that may match each ascii char
+	trie       *keywordTrie // finds the matching alternatives of a choice of literals
+}
+
+// newDispatch builds the dispatch table of a choice. An alternative is always evaluated if it
+// can match empty, it may start with a white space, which may be skipped already, or the result
+// of its failure can't be told in advance.
+func (inst *Analysis) newDispatch(choice *ChoiceRule) *choiceDispatch {
+	dispatch := &choiceDispatch{}
+	for _, alt := range subRules(choice) {
+		first := inst.FirstOf(alt)
+		sticky, known := inst.failSticky(alt, make(map[string]bool))
+		always := !known || nullable(alt, inst.nullables) || first.Intersects(whiteSpaces)
+		dispatch.firsts = append(dispatch.firsts, first)
+		dispatch.always = append(dispatch.always, always)
+		dispatch.failSticky = append(dispatch.failSticky, sticky)
+	}
+	for char := range dispatch.ascii {
+		dispatch.ascii[char] = dispatch.scan(rune(char))
+	}
+	dispatch.trie = newKeywordTrie(choice, inst.grammar.ignoreCase)
+	return dispatch
+}
+
+// failSticky returns the stickiness of the result of a rule failing at the first char, which is
+// taken by a choice for an alternative not evaluated. known is false if it depends on the input.
+func (inst *Analysis) failSticky(rule IRule, visiting map[string]bool) (sticky bool, known bool) {
+	switch r := rule.(type) {
+	case *TerminalStringRule, *BlockRule:
+		return false, true
+	case *TerminalCharsRule, *TerminalCharRule, *TerminalRangeRule, *TerminalClassRule,
+		*TerminalSetRule, *TerminalAnyRule:
+		return true, true
+	case *GroupRule:
+		return inst.failSticky(r.rule, visiting)
+	case *DifferenceRule:
+		return inst.failSticky(r.rule, visiting)
+	case *RepetitionRule:
+		if r.min > 0 {
+			return inst.failSticky(r.rule, visiting)
+		}
+	case *ConcatenateRule:
+		if !nullable(r.rules[0], inst.nullables) {
+			return inst.failSticky(r.rules[0], visiting)
+		}
+	case *ChoiceRule:
+		sticky = true
+		for _, alt := range subRules(r) {
+			altSticky, known := inst.failSticky(alt, visiting)
+			if !known {
+				return false, false
+			}
+			sticky = sticky && altSticky
+		}
+		return sticky, true
+	case *ReferenceRule:
+		record := inst.grammar.GetRecord(r.refName)
+		if record == nil || visiting[r.refName] || inst.grammar.leftRecursion().rules[r.refName] {
+			return false, false // a left-recursive rule may fail with its seed
+		}
+		visiting[r.refName] = true
+		defer delete(visiting, r.refName)
+		return inst.failSticky(record.rule, visiting)
+	}
+	return false, false // EOF, predicates and options match empty
+}
+
+// scan finds the alternatives that may match a char
+func (inst *choiceDispatch) scan(char rune) []int {
+	var alts []int
+	for i, first := range inst.firsts {
+		if inst.always[i] || first.Contains(char) {
+			alts = append(alts, i)
+		}
+	}
+	return alts
+}
+
+func (inst *choiceDispatch) lookup(char rune) []int {
+	if char >= 0 && int(char) < len(inst.ascii) {
+		return inst.ascii[char]
+	}
+	return inst.scan(char)
+}
+
+// candidates returns the alternatives that may match, in order. An alternative may see the char
+// at the cursor or the next char after the insignificant chars, depending on whether it skips.
+func (inst *choiceDispatch) candidates(char rune, next rune) []int {
+	if next == char || IsWhiteSpace(char) {
+		// the alternatives starting with a white space are always evaluated
+		return inst.lookup(next)
+	}
+	a, b := inst.lookup(char), inst.lookup(next)
+	alts := make([]int, 0, len(a)+len(b))
+	for len(a) > 0 || len(b) > 0 {
+		switch {
+		case len(b) == 0 || (len(a) > 0 && a[0] < b[0]):
+			alts, a = append(alts, a[0]), a[1:]
+		case len(a) == 0 || b[0] < a[0]:
+			alts, b = append(alts, b[0]), b[1:]
+		default:
+			alts, a, b = append(alts, a[0]), a[1:], b[1:]
+		}
+	}
+	return alts
+}
+
+// dispatchTables builds the dispatch tables of all choices of the grammar
+func (inst *Analysis) dispatchTables() map[*ChoiceRule]*choiceDispatch {
+	tables := make(map[*ChoiceRule]*choiceDispatch)
+	for _, record := range inst.grammar.ruleRecords {
+		walkRule(record.rule, func(rule IRule) {
+			if choice, ok := rule.(*ChoiceRule); ok {
+				tables[choice] = inst.newDispatch(choice)
+			}
+		})
+	}
+	return tables
+}
+
+// SetDispatch turns on or off the dispatch tables of the choices, it's on by default. With the
+// dispatch tables, only the alternatives that may start with the next char are evaluated, the
+// results are the same either way.
+func (inst *Grammar) SetDispatch(enabled bool) {
+	inst.noDispatch = !enabled
+}
@@ -0,0 +1,126 @@
+package xbnf
+
+import (
+	"fmt"
+	"sort"
+	"unicode"
+)
+
+// CaseInsensitiveSymbol prefixes a string or chars literal to match it case-insensitively, for
+// example i"select" or i'abc'
+const CaseInsensitiveSymbol = 'i'
+
+// equalFold checks whether 2 chars are equal under unicode simple case folding
+func equalFold(a, b rune) bool {
+	if a == b {
+		return true
+	}
+	for folded := unicode.SimpleFold(a); folded != a; folded = unicode.SimpleFold(folded) {
+		if folded == b {
+			return true
+		}
+	}
+	return false
+}
+
+// foldKey returns the smallest char of the chars equal to the char under simple case folding, 2
+// chars are equal under folding if they have the same key
+func foldKey(char rune) rune {
+	key := char
+	for folded := unicode.SimpleFold(char); folded != char; folded = unicode.SimpleFold(folded) {
+		if folded < key {
+			key = folded
+		}
+	}
+	return key
+}
+
+// matchText matches the text at the cursor of the charstream, case-insensitively if fold is true.
+// The chars read from the charstream are returned, so the original input text is kept.
+func matchText(charstream ICharstream, text []rune, fold bool) ([]rune, bool) {
+	if !fold {
+		return charstream.Match(text)
+	}
+	var result []rune
+	for _, textChar := range text {
+		char := charstream.Next()
+		if char == EOFChar {
+			return result, false
+		}
+		result = append(result, char)
+		if !equalFold(char, textChar) {
+			return result, false
+		}
+	}
+	return result, true
+}
+
+// isCaseInsensitiveLiteral checks whether the charstream starts with a case-insensitive literal,
+// ie. an 'i' followed by a quote.
+func isCaseInsensitiveLiteral(cs ICharstream) bool {
+	if cs.Peek() != CaseInsensitiveSymbol {
+		return false
+	}
+	start := cs.Cursor()
+	cs.Next()
+	quote := cs.Peek()
+	cs.Seek(start)
+	return quote == '"' || quote == CharsSymbol
+}
+
+// inCaseInsensitive expects the 1st char in the input charstream is an 'i' followed by a string
+// or chars literal.
+func inCaseInsensitive(name string, cs ICharstream) (IRule, error) {
+	if cs.Next() != CaseInsensitiveSymbol {
+		return nil, fmt.Errorf("case-insensitive literal must start with '%c'", CaseInsensitiveSymbol)
+	}
+	if cs.Peek() == '"' {
+		rule, err := inString(name, cs)
+		if err != nil {
+			return nil, err
+		}
+		rule.caseInsensitive = true
+		return rule, nil
+	}
+	rule, err := inChar(cs)
+	if err != nil {
+		return nil, err
+	}
+	switch r := rule.(type) {
+	case *TerminalCharRule:
+		r.caseInsensitive = true
+	case *TerminalCharsRule:
+		r.caseInsensitive = true
+	default:
+		return nil, fmt.Errorf("case-insensitive prefix '%c' can't apply to %s", CaseInsensitiveSymbol, rule.String())
+	}
+	return rule, nil
+}
+
+// checkCaseInsensitivePrefix rejects the case-insensitive literals of a grammar having a rule
+// named i, as i"x" is also a reference to the rule followed by "x".
+func (inst *Grammar) checkCaseInsensitivePrefix() error {
+	prefix := string(CaseInsensitiveSymbol)
+	if inst.ruleRecords[prefix] == nil {
+		return nil
+	}
+	var names []string
+	for name := range inst.ruleRecords {
+		names = append(names, name)
+	}
+	sort.Strings(names)
+	for _, name := range names {
+		record := inst.ruleRecords[name]
+		var literal IRule
+		walkRule(record.rule, func(rule IRule) {
+			if _, fold, ok := literalText(rule); ok && fold && literal == nil {
+				literal = rule
+			}
+		})
+		if literal != nil {
+			return fmt.Errorf("case-insensitive literal %s of rule '%s' at %s is ambiguous with the rule '%s', put a space after %s to reference the rule, or rename it",
+				literal.String(), name, record.where(), prefix, prefix)
+		}
+	}
+	return nil
+}
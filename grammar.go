@@ -1,8 +1,11 @@
 package xbnf
 
 import (
+	"context"
 	"fmt"
+	"io/fs"
 	"io/ioutil"
+	"path/filepath"
 	"sort"
 	"strings"
 )
@@ -27,18 +30,30 @@ const (
 	CharRangeSymbol       = '-'
 	CharsSymbol           = '\''
 	EscapeSymbol          = '\\'
+	AndPredicateSymbol    = '&'
+	NotPredicateSymbol    = '!'
 )
 
 type RuleRecord struct {
-	name string
-	rule IRule
-	line int
+	name     string
+	rule     IRule
+	line     int
+	file     string // the file defining the rule, if available
+	imported bool   // defined in an imported file
 }
 
 func (inst *RuleRecord) Rule() IRule {
 	return inst.rule
 }
 
+// where returns the file and line defining the rule
+func (inst *RuleRecord) where() string {
+	if inst.file == "" {
+		return fmt.Sprintf("line %d", inst.line)
+	}
+	return fmt.Sprintf("%s line %d", inst.file, inst.line)
+}
+
 func NewGrammar() *Grammar {
 	grammar := &Grammar{}
 	grammar.ruleRecords = make(map[string]*RuleRecord)
@@ -50,6 +65,7 @@ func NewGrammar() *Grammar {
 
 type Grammar struct {
 	fileName    string
+	fsys        fs.FS                  // the file system the grammar is loaded from, nil for the OS files
 	ruleRecords map[string]*RuleRecord // all rules along with name an line # defined in file
 	nonRoots    map[string][]string    // key is rule that is referenced by at least 1 child rule
 	terminals   map[string]*RuleRecord // all rules that has no child rule
@@ -57,6 +73,28 @@ type Grammar struct {
 	maxLine     int
 	//lock        sync.RWMutex
 	validated bool
+
+	memoEnabled    bool
+	memoMaxEntries int
+	memoStats      MemoStats
+	state          *evalState // states of the evaluation in progress
+
+	noLeftRecursion bool           // left recursion support is disabled
+	lr              *leftRecursion // cached left recursion analysis, nil if rules changed
+	analysis        *Analysis      // cached FIRST and FOLLOW analysis, nil if rules changed
+	limits          Limits         // limits of the evaluations, see SetLimits
+	noDispatch      bool           // dispatch tables of the choices are disabled
+	tracer          Tracer         // receives the events of the evaluations, see SetTracer
+	profiler        *Profiler      // collects the profiles of the rules, see SetProfiler
+
+	syncRules []string // rules to resume the evaluation at after a failure, see EvalWithRecovery
+	startRule string   // the only rule evaluated at the top level if set, see SetStartRule
+
+	ignoreCase bool   // all string and chars literals are case-insensitive
+	skipRule   string // the rule that defines the insignificant chars, see SetSkipRule
+
+	loading  *loadContext    // the file being loaded, nil if not loading
+	imported map[string]bool // files imported, with the namespace
 }
 
 func (inst *Grammar) desc() string {
@@ -101,9 +139,10 @@ func (inst *Grammar) ParseRule(name string, ruleStr string) (IRule, error) {
 	if err != nil {
 		return nil, err
 	}
+	ruleName = inst.loading.qualify(ruleName)
 	ruleRecord, exists := inst.ruleRecords[ruleName]
 	if exists {
-		return nil, fmt.Errorf("rule '%s' already defined at line %d", name, ruleRecord.line)
+		return nil, fmt.Errorf("rule '%s' already defined at %s", ruleName, ruleRecord.where())
 	}
 	ruleStr = strings.TrimSpace(ruleStr)
 	var rule IRule
@@ -124,7 +163,13 @@ func (inst *Grammar) ParseRule(name string, ruleStr string) (IRule, error) {
 	record.line = inst.maxLine
 	record.rule = rule
 	record.name = ruleName
+	if inst.loading != nil {
+		record.file = inst.loading.file
+		record.imported = inst.loading.parent != nil
+	}
 	inst.ruleRecords[ruleName] = record
+	inst.lr = nil
+	inst.analysis = nil
 
 	return rule, nil
 }
@@ -146,21 +191,30 @@ func (inst *Grammar) Serialize(withDetail bool) string {
 	//inst.lock.RLock()
 	//defer inst.lock.RUnlock()
 	var maxNameLen int
-	byLine := make(map[int]*RuleRecord)
-	var lines []int
+	var records []*RuleRecord
 	for _, record := range inst.ruleRecords {
 		if len(record.name) > maxNameLen {
 			maxNameLen = len(record.name)
 		}
-		byLine[record.line] = record
-		lines = append(lines, record.line)
+		records = append(records, record)
 	}
 	maxNameLen = maxNameLen + 4 // all for [T] to indicate it's a terminal rule and optional ! for virtual
-	sort.Ints(lines)
+	// rules of the grammar first, then the imported ones by file
+	sort.Slice(records, func(i, j int) bool {
+		if records[i].imported != records[j].imported {
+			return !records[i].imported
+		}
+		if records[i].file != records[j].file {
+			return records[i].file < records[j].file
+		}
+		return records[i].line < records[j].line
+	})
 	nameFmtStr := fmt.Sprintf("%%-%ds", maxNameLen)
 	var buf strings.Builder
-	for _, line := range lines {
-		record := byLine[line]
+	for _, record := range records {
+		if record.imported {
+			buf.WriteString(record.file + ":")
+		}
 		buf.WriteString(fmt.Sprintf("L%04d: ", record.line))
 		ruleName := record.name
 		if record.rule.IsVirtual() {
@@ -218,6 +272,9 @@ func (inst *Grammar) Validate() error {
 	for name, children := range inst.nonRoots {
 		_, exists := inst.ruleRecords[name]
 		if !exists {
+			if user := inst.ruleRecords[children[0]]; user != nil {
+				return fmt.Errorf("rule name '%s' referenced but not defined, used by rule '%s' at %s", name, user.name, user.where())
+			}
 			return fmt.Errorf("rule name '%s' referenced but not defined", name)
 		}
 		for _, child := range children {
@@ -233,34 +290,121 @@ func (inst *Grammar) Validate() error {
 	}
 	for name, ruleRecord := range inst.ruleRecords {
 		_, exists := inst.nonRoots[name]
-		if !exists {
+		if !exists && name != inst.skipRule && !ruleRecord.imported {
 			inst.rootRules[name] = ruleRecord
 		}
 	}
+	lr := inst.leftRecursion()
+	if inst.noLeftRecursion && len(lr.cycles) > 0 {
+		var cycles []string
+		for _, cycle := range lr.cycles {
+			cycles = append(cycles, strings.Join(cycle, " -> "))
+		}
+		return fmt.Errorf("left recursion found: %s", strings.Join(cycles, "; "))
+	}
+	if !inst.noLeftRecursion && lr.err != nil {
+		return lr.err
+	}
+	for _, name := range inst.syncRules {
+		if _, exists := inst.ruleRecords[name]; !exists {
+			return fmt.Errorf("sync rule '%s' not defined", name)
+		}
+	}
+	if err := inst.checkCaseInsensitivePrefix(); err != nil {
+		return err
+	}
+	if inst.startRule != "" {
+		if _, exists := inst.ruleRecords[inst.startRule]; !exists {
+			return fmt.Errorf("start rule '%s' not defined", inst.startRule)
+		}
+	}
+	if inst.skipRule != "" {
+		if _, exists := inst.ruleRecords[inst.skipRule]; !exists {
+			return fmt.Errorf("skip rule '%s' not defined", inst.skipRule)
+		}
+	}
 	return nil
 }
 
+// SetStartRule makes the rule the only one evaluated at the top level by Eval, instead of all
+// root rules, so helper rules that nobody references don't compete with it. It's the same as the
+// `@start` directive in a grammar file. An empty name restores the root rules.
+func (inst *Grammar) SetStartRule(name string) {
+	inst.startRule = name
+	inst.analysis = nil
+}
+
+// SetSkipRule replaces the white spaces skipped between tokens by the matches of the rule, for
+// example a rule of white spaces and comments. It's the same as the `@skip` directive in a
+// grammar file. The skip rule is never a root rule. An empty name restores the white spaces.
+func (inst *Grammar) SetSkipRule(name string) {
+	inst.skipRule = name
+	delete(inst.rootRules, name)
+	inst.analysis = nil
+}
+
+// SetIgnoreCase makes all string and chars literals case-insensitive, as if they are all prefixed
+// by 'i'. It's the same as the `@ignorecase` directive in a grammar file.
+func (inst *Grammar) SetIgnoreCase(ignoreCase bool) {
+	inst.ignoreCase = ignoreCase
+	inst.analysis = nil
+}
+
+// topRules returns the rules evaluated at the top level: the start rule if it's set, otherwise
+// the root rules.
+func (inst *Grammar) topRules() map[string]*RuleRecord {
+	if inst.startRule != "" {
+		if record := inst.GetRecord(inst.startRule); record != nil {
+			return map[string]*RuleRecord{record.name: record}
+		}
+	}
+	return inst.rootRules
+}
+
+// SetLeftRecursion turns on or off the support of left-recursive rules, it's on by default.
+// When it's off, Validate() reports left-recursive rules as errors.
+func (inst *Grammar) SetLeftRecursion(enabled bool) {
+	inst.noLeftRecursion = !enabled
+}
+
+// leftRecursion returns the left recursion analysis of the rules, which is cached until a
+// rule is added.
+func (inst *Grammar) leftRecursion() *leftRecursion {
+	if inst.lr == nil {
+		inst.lr = inst.analyzeLeftRecursion()
+	}
+	return inst.lr
+}
+
 // EvalEmbed parse a string by a rule in a fashion that it evals the rule at the 1st char, if match, it
 // continues eval starting at the 1st char right after the matched chars. If not match, it starts match
 // starting on the next char, and so on. A node is returned when there is at least 1 match, and has type
 // "embed", the child nodes of the return node contains the rule matched node(s) and leaf node contains
 // the unmatched texts
 func (inst *Grammar) EvalEmbed(ruleName string, sample string) *EvalResult {
+	return inst.EvalEmbedCharstream(ruleName, NewCharstreamFromString(sample))
+}
+
+// EvalEmbedCharstream is the same as EvalEmbed, except the text is read from a charstream.
+func (inst *Grammar) EvalEmbedCharstream(ruleName string, charstream ICharstream) *EvalResult {
 	evalResult := &EvalResult{}
 	record := inst.GetRecord(ruleName)
 	if record == nil {
 		evalResult.Error = fmt.Errorf("rule '%s' not defined", ruleName)
 		return evalResult
 	}
-	rule := record.Rule()
+	defer inst.beginEval()()
 	node := &Node{RuleType: TypeEmbed, RuleName: ruleName}
 	evalResult.Node = node
-	cs := NewCharstreamFromString(sample)
+	cs := charstream
 	var result *EvalResult
 	var text []rune
 	for {
-		result = rule.Eval(inst, cs, NOT_SKIP)
-		cs = newCharstreamPrepend(cs, result.CharsUnused)
+		result = inst.evalRecord(record, cs, NOT_SKIP)
+		if inst.state.abort != nil {
+			return &EvalResult{Error: inst.state.abort}
+		}
+		cs.Release(cs.Cursor())
 		if result.Node == nil { // no match
 			char := cs.Next()
 			if char == EOFChar {
@@ -293,18 +437,40 @@ func (inst *Grammar) EvalRule(ruleName string, sample string) *EvalResult {
 		evalResult.Error = fmt.Errorf("rule '%s' not defined", ruleName)
 		return evalResult
 	}
-	rule := record.Rule()
+	defer inst.beginEval()()
 	cs := NewCharstreamFromString(sample)
-	return rule.Eval(inst, cs, SUGGEST_SKIP)
+	evalResult = inst.evalRecord(record, cs, SUGGEST_SKIP)
+	if inst.state.abort != nil {
+		evalResult.Node = nil
+		evalResult.Error = inst.state.abort
+	} else if evalResult.Node == nil {
+		evalResult.Error = inst.parseError(cs)
+	}
+	return evalResult
 }
 
 func (inst *Grammar) Eval(charstream ICharstream, simplifyLevel int) (*AST, error) {
-	ast, err := inst.EvalRaw(charstream)
-	if err != nil {
-		return nil, err
-	}
+	return inst.EvalContext(context.Background(), charstream, simplifyLevel)
+}
+
+// EvalFrom is the same as Eval, except the text is parsed by the rule, regardless of the root
+// rules and the start rule.
+func (inst *Grammar) EvalFrom(ruleName string, charstream ICharstream, simplifyLevel int) (*AST, error) {
+	return inst.EvalFromContext(context.Background(), ruleName, charstream, simplifyLevel)
+}
+
+// EvalWithRecovery is the same as Eval, except it doesn't stop at the first failure. When no
+// root rule matches, the chars are skipped up to the end of the next match of a sync rule (see
+// SetSyncRules), or to EOF, and the evaluation continues after them. The skipped chars are kept
+// in an error node of the AST. It returns the partial AST and the failures found, the error is
+// returned only when the evaluation can't go on.
+func (inst *Grammar) EvalWithRecovery(charstream ICharstream, simplifyLevel int) (*AST, []*ParseError, error) {
+	return inst.EvalWithRecoveryContext(context.Background(), charstream, simplifyLevel)
+}
+
+func simplify(ast *AST, simplifyLevel int) {
 	if simplifyLevel == LevelRaw {
-		return ast, nil
+		return
 	}
 	switch simplifyLevel {
 	case LevelDataOnly:
@@ -318,68 +484,85 @@ func (inst *Grammar) Eval(charstream ICharstream, simplifyLevel int) (*AST, erro
 		ast.MergeStickyNodes()
 	}
 	ast.RemoveRedundantNodes()
-	return ast, nil
 }
 
 // Evaluate is the driver of parsing.
 func (inst *Grammar) EvalRaw(charstream ICharstream) (*AST, error) {
+	ast, _, err := inst.evalRaw(context.Background(), charstream, inst.topRules(), false)
+	return ast, err
+}
+
+// evalRaw evaluates the top rules until EOF. If recovery is false, the first failure is returned
+// as the error, otherwise the failures are returned as diagnostics, see EvalWithRecovery.
+func (inst *Grammar) evalRaw(ctx context.Context, charstream ICharstream, topRules map[string]*RuleRecord, recovery bool) (*AST, []*ParseError, error) {
 	if charstream.Peek() == EOFChar {
-		return nil, fmt.Errorf("Empty Stream/EOF encountered")
+		return nil, nil, fmt.Errorf("Empty Stream/EOF encountered")
 	}
-	ast := &AST{}
+	defer inst.beginEval()()
+	inst.state.ctx = ctx
+	inst.state.recovery = recovery
+	ast := &AST{Filename: inst.fileName}
+	var diagnostics []*ParseError
 	cs := charstream
-	var charsUnused []rune
 	flagLeadingSpaces := SUGGEST_SKIP
 	for {
-		cs = newCharstreamPrepend(cs, charsUnused)
+		// the insignificant chars at the end are not a failure, even after a sticky node
+		cursor := cs.Cursor()
+		inst.skip(cs)
+		if cs.Peek() != EOFChar {
+			cs.Seek(cursor)
+		}
+		if err := inst.checkLimits(cs, nil); err != nil {
+			return nil, diagnostics, err
+		}
 		if cs.Peek() == EOFChar {
 			break
 		}
+		// every root rule is evaluated from the same cursor
+		start := cs.Cursor()
 		resultsMatched := make(map[string]*EvalResult)
-		resultsError := make(map[string]*EvalResult)
-		var maxCharsRead []rune
-		for name, ruleRecord := range inst.rootRules {
-			cs = newCharstreamPrepend(cs, maxCharsRead)
-			result := ruleRecord.rule.Eval(inst, cs, flagLeadingSpaces)
-			if len(maxCharsRead) < len(result.CharsRead) {
-				maxCharsRead = result.CharsRead
-			}
+		for name, ruleRecord := range topRules {
+			cs.Seek(start)
+			result := inst.evalRecord(ruleRecord, cs, flagLeadingSpaces)
 			if result.Node != nil {
 				resultsMatched[name] = result
 			}
-			if result.Error != nil {
-				resultsError[name] = result
-			}
+		}
+		if err := inst.state.abort; err != nil {
+			return nil, diagnostics, err
 		}
 		matches := len(resultsMatched)
 		switch matches {
 		case 0:
-			var buf strings.Builder
-			for _, result := range resultsError {
-				buf.WriteString(fmt.Sprintf("%s; ", result.Error))
+			parseErr := inst.parseError(cs)
+			if !recovery {
+				return nil, nil, parseErr
 			}
-			return nil, fmt.Errorf("must be %s: %s", inst.desc(), buf.String())
+			diagnostics = append(diagnostics, parseErr)
+			ast.Nodes = append(ast.Nodes, inst.skipToSync(cs, start, parseErr.Cursor, parseErr, true))
+			flagLeadingSpaces = SUGGEST_SKIP
 		case 1:
 			var result *EvalResult
 			for _, r := range resultsMatched {
 				result = r
 			}
 			ast.Nodes = append(ast.Nodes, result.Node)
+			diagnostics = collectDiagnostics(result.Node, diagnostics)
 			if result.Sticky {
 				flagLeadingSpaces = SUGGEST_NOT_SKIP
 			} else {
 				flagLeadingSpaces = SUGGEST_SKIP
 			}
-			charsUnused = maxCharsRead[result.countCharsUsed():]
+			cs.Seek(result.End)
 		default: // we found more than 1 matches, the most greedy one wins
 			maxCountCharsUsed := 0
 			var maxResult *EvalResult
 			for _, result := range resultsMatched {
 				countCharsUsed := result.countCharsUsed()
 				if countCharsUsed == maxCountCharsUsed && maxResult != nil {
-					return nil, fmt.Errorf("ambiguity found: %s(\"%s\") vs %s(\"%s\")",
-						result.Node.RuleName, string(result.CharsRead),
-						maxResult.Node.RuleName, string(maxResult.CharsRead))
+					return nil, diagnostics, fmt.Errorf("ambiguity found: %s(\"%s\") vs %s(\"%s\")",
+						result.Node.RuleName, string(result.Node.Text()),
+						maxResult.Node.RuleName, string(maxResult.Node.Text()))
 				}
 				if countCharsUsed >= maxCountCharsUsed {
 					maxResult = result
@@ -387,19 +570,21 @@ func (inst *Grammar) EvalRaw(charstream ICharstream) (*AST, error) {
 				}
 			}
 			ast.Nodes = append(ast.Nodes, maxResult.Node)
+			diagnostics = collectDiagnostics(maxResult.Node, diagnostics)
 			if maxResult.Sticky {
 				flagLeadingSpaces = SUGGEST_NOT_SKIP
 			} else {
 				flagLeadingSpaces = SUGGEST_SKIP
 			}
-			charsUnused = maxCharsRead[maxResult.countCharsUsed():]
+			cs.Seek(maxResult.End)
 		}
-		cs = charstream
+		// the chars before the cursor will never be read again
+		cs.Release(cs.Cursor())
 	}
 	if len(ast.Nodes) == 0 {
-		return nil, fmt.Errorf("no AST node found")
+		return nil, diagnostics, fmt.Errorf("no AST node found")
 	}
-	return ast, nil
+	return ast, diagnostics, nil
 }
 
 // parse a rule using the chars up to the terminator chars. The terminator chars won't be
@@ -445,6 +630,16 @@ EXIT:
 				return nil, fmt.Errorf("annotation symbol '%c' can not appear before choice symbol '%c'", char, ChoiceSymbol)
 			}
 			continue
+		case AndPredicateSymbol, NotPredicateSymbol: // '&' or '!'
+			rule, err := inPredicate(inst, name, cs)
+			if err != nil {
+				return nil, err
+			}
+			rule.setAnnotation(isTokenized, isNonData, isVirtual)
+			isTokenized = false
+			isNonData = false
+			isVirtual = false
+			rules = append(rules, rule)
 		case '\'':
 			rule, err := inChar(cs)
 			if err != nil {
@@ -455,8 +650,18 @@ EXIT:
 			isNonData = false
 			isVirtual = false
 			rules = append(rules, rule)
-		case '\\':
-			rule, err := inUnicode(cs)
+		case EscapeSymbol: // '\\'
+			rule, err := inEscape(cs)
+			if err != nil {
+				return nil, err
+			}
+			rule.setAnnotation(isTokenized, isNonData, isVirtual)
+			isTokenized = false
+			isNonData = false
+			isVirtual = false
+			rules = append(rules, rule)
+		case AnyCharSymbol: // '.'
+			rule, err := inAny(cs)
 			if err != nil {
 				return nil, err
 			}
@@ -502,6 +707,21 @@ EXIT:
 				isVirtual = false
 				rules[size-1] = rule
 			}
+		case CharRangeSymbol: // must be the difference operator "--"
+			size := len(rules)
+			if size == 0 {
+				return nil, fmt.Errorf("Difference operator must in between rules")
+			}
+			// last rule will be replaced by the difference rule
+			rule, err := inDifference(inst, name, rules[size-1], cs)
+			if err != nil {
+				return nil, err
+			}
+			rule.setAnnotation(isTokenized, isNonData, isVirtual)
+			isTokenized = false
+			isNonData = false
+			isVirtual = false
+			rules[size-1] = rule
 		case OptionOpenSymbol: // '['
 			rule, err := inOption(inst, name, cs)
 			if err != nil {
@@ -557,9 +777,22 @@ EXIT:
 				}
 				comment = append(comment, char)
 			}
+			if char == '\n' { // a multi-line rule goes on after the comment
+				continue
+			}
 			break EXIT
 		default:
-			if (char >= 'a' && char <= 'z') || (char >= 'A' && char <= 'Z') || char == '_' {
+			if isCaseInsensitiveLiteral(cs) {
+				rule, err := inCaseInsensitive(name, cs)
+				if err != nil {
+					return nil, err
+				}
+				rule.setAnnotation(isTokenized, isNonData, isVirtual)
+				isTokenized = false
+				isNonData = false
+				isVirtual = false
+				rules = append(rules, rule)
+			} else if (char >= 'a' && char <= 'z') || (char >= 'A' && char <= 'Z') || char == '_' {
 				rule, err := inReference(inst, name, cs)
 				if err != nil {
 					return nil, err
@@ -621,8 +854,15 @@ func (inst *Grammar) parseOne(name string, cs ICharstream) (IRule, error) {
 			}
 			rule.setAnnotation(isTokenized, isNonData, isVirtual)
 			return rule, nil
-		case '\\':
-			rule, err := inUnicode(cs)
+		case EscapeSymbol: // '\\'
+			rule, err := inEscape(cs)
+			if err != nil {
+				return nil, err
+			}
+			rule.setAnnotation(isTokenized, isNonData, isVirtual)
+			return rule, nil
+		case AnyCharSymbol: // '.'
+			rule, err := inAny(cs)
 			if err != nil {
 				return nil, err
 			}
@@ -663,7 +903,22 @@ func (inst *Grammar) parseOne(name string, cs ICharstream) (IRule, error) {
 			}
 			rule.setAnnotation(isTokenized, isNonData, isVirtual)
 			return rule, nil
+		case AndPredicateSymbol, NotPredicateSymbol: // '&' or '!'
+			rule, err := inPredicate(inst, name, cs)
+			if err != nil {
+				return nil, err
+			}
+			rule.setAnnotation(isTokenized, isNonData, isVirtual)
+			return rule, nil
 		default:
+			if isCaseInsensitiveLiteral(cs) {
+				rule, err := inCaseInsensitive(name, cs)
+				if err != nil {
+					return nil, err
+				}
+				rule.setAnnotation(isTokenized, isNonData, isVirtual)
+				return rule, nil
+			}
 			if (char >= 'a' && char <= 'z') || (char >= 'A' && char <= 'Z') || char == '_' {
 				rule, err := inReference(inst, name, cs)
 				if err != nil {
@@ -682,41 +937,126 @@ func NewGrammarFromFile(filexbnf string) (*Grammar, error) {
 	if err != nil {
 		return nil, fmt.Errorf("can't real file: %s", err)
 	}
-	grammar, err := NewGrammarFromString(string(xbnfText))
+	grammar := NewGrammar()
+	grammar.fileName = filexbnf
+	err = grammar.load(string(xbnfText), &loadContext{file: filepath.Clean(filexbnf)})
 	if err == nil {
-		grammar.fileName = filexbnf
-		return grammar, nil
+		err = grammar.Validate()
 	}
-	err = fmt.Errorf("%s: %s", filexbnf, err)
-	return nil, err
+	if err != nil {
+		return nil, fmt.Errorf("%s: %s", filexbnf, err)
+	}
+	return grammar, nil
+}
+
+// isRuleHead checks whether a line starts a rule definition, ie. a single word followed by a '='.
+// The name is validated later, a '=' in a rule definition is always quoted.
+func isRuleHead(line string) bool {
+	i := strings.IndexByte(line, '=')
+	if i < 0 {
+		return false
+	}
+	name := strings.TrimSpace(line[:i])
+	return name != "" && !strings.ContainsAny(name, " \t'\"")
+}
+
+// NewGrammarFromFS creates a Grammar object from a file in a file system, such as an embed.FS
+// or an os.DirFS. Imported files are looked up in the same file system, relative to the
+// importing file.
+func NewGrammarFromFS(fsys fs.FS, path string) (*Grammar, error) {
+	xbnfText, err := fs.ReadFile(fsys, path)
+	if err != nil {
+		return nil, fmt.Errorf("can't read file: %s", err)
+	}
+	grammar := NewGrammar()
+	grammar.fileName = path
+	grammar.fsys = fsys
+	err = grammar.load(string(xbnfText), &loadContext{file: path})
+	if err == nil {
+		err = grammar.Validate()
+	}
+	if err != nil {
+		return nil, fmt.Errorf("%s: %s", path, err)
+	}
+	return grammar, nil
 }
 
 // NewGrammarFromString creates a Grammar object from a string in which each
-// line is a rule definition with a name.
+// rule definition starts with a name at a new line. A rule definition goes on
+// in the following lines until the next rule definition or directive.
 func NewGrammarFromString(grammarText string) (*Grammar, error) {
 	grammar := NewGrammar()
+	if err := grammar.load(grammarText, &loadContext{}); err != nil {
+		return nil, err
+	}
+	err := grammar.Validate()
+	if err != nil {
+		return nil, err
+	}
+	return grammar, nil
+}
+
+// load parses the rule definitions and directives of a grammar text into the grammar. Imported
+// files are loaded recursively with their own contexts.
+func (inst *Grammar) load(grammarText string, context *loadContext) error {
+	saved := inst.loading
+	inst.loading = context
+	defer func() { inst.loading = saved }()
+	var name string      // name of the rule being defined
+	var ruleStr []string // lines of the rule being defined
+	var ruleLine, endLine int
+	parseRule := func() error {
+		if name == "" {
+			return nil
+		}
+		inst.maxLine = ruleLine - 1 // the rule is recorded at the line of its name
+		_, err := inst.ParseRule(name, strings.Join(ruleStr, "\n"))
+		if err != nil {
+			return fmt.Errorf("L#%d: rule [%s] - %s", ruleLine, name, err)
+		}
+		inst.maxLine = endLine
+		name = ""
+		ruleStr = nil
+		return nil
+	}
 	lines := strings.Split(grammarText, "\n")
 	for i, line := range lines {
 		line = strings.TrimSpace(line)
 		if len(line) == 0 || strings.HasPrefix(line, "//") {
-			grammar.maxLine = i + 1
+			if name == "" {
+				inst.maxLine = i + 1
+			}
 			continue // empty line or comments
 		}
-		tokens := strings.SplitN(line, "=", 2)
-		if len(tokens) != 2 {
-			return nil, fmt.Errorf("L#%d: invalid(missing =): %s", i+1, line)
+		if line[0] == DirectiveSymbol {
+			if err := parseRule(); err != nil {
+				return err
+			}
+			if err := inst.parseDirective(line); err != nil {
+				return fmt.Errorf("L#%d: %s", i+1, err)
+			}
+			inst.maxLine = i + 1
+			continue
 		}
-		name := strings.TrimSpace(tokens[0])
-		ruleStr := strings.TrimSpace(tokens[1])
-		_, err := grammar.ParseRule(name, ruleStr)
-		if err != nil {
-			return nil, fmt.Errorf("L#%d: rule [%s] - %s", i+1, name, err)
+		if !isRuleHead(line) {
+			if name == "" {
+				return fmt.Errorf("L#%d: invalid(missing =): %s", i+1, line)
+			}
+			ruleStr = append(ruleStr, line) // continuation of the rule
+			endLine = i + 1
+			continue
+		}
+		if err := parseRule(); err != nil {
+			return err
 		}
-		grammar.maxLine = i + 1
+		tokens := strings.SplitN(line, "=", 2)
+		name = strings.TrimSpace(tokens[0])
+		ruleStr = []string{strings.TrimSpace(tokens[1])}
+		ruleLine = i + 1
+		endLine = i + 1
 	}
-	err := grammar.Validate()
-	if err != nil {
-		return nil, err
+	if err := parseRule(); err != nil {
+		return err
 	}
-	return grammar, nil
+	return nil
 }
@@ -0,0 +1,106 @@
+package xbnf
+
+import (
+	"fmt"
+	"io/fs"
+	"io/ioutil"
+	"path"
+	"path/filepath"
+	"strings"
+)
+
+// NamespaceSymbol separates the namespace and the name of an imported rule, such as `common.integer`
+const NamespaceSymbol = '.'
+
+// loadContext is a grammar text being loaded, the main grammar or an imported file
+type loadContext struct {
+	file      string // empty if the grammar is not loaded from a file
+	namespace string // full namespace of the rules defined, empty for the main grammar
+	parent    *loadContext
+}
+
+// qualify returns the name of a rule defined or referenced in the context
+func (inst *loadContext) qualify(name string) string {
+	if inst == nil || inst.namespace == "" {
+		return name
+	}
+	return inst.namespace + string(NamespaceSymbol) + name
+}
+
+// resolve returns the path of a file imported by another one. The path is relative to the
+// importing file, in the file system of the grammar if any.
+func (inst *Grammar) resolve(from string, file string) string {
+	if inst.fsys != nil {
+		if from != "" {
+			file = path.Join(path.Dir(from), file)
+		}
+		return path.Clean(file)
+	}
+	if from != "" && !filepath.IsAbs(file) {
+		file = filepath.Join(filepath.Dir(from), file)
+	}
+	return filepath.Clean(file)
+}
+
+// readFile reads a file from the file system of the grammar, or from the OS if there is none
+func (inst *Grammar) readFile(file string) ([]byte, error) {
+	if inst.fsys != nil {
+		return fs.ReadFile(inst.fsys, file)
+	}
+	return ioutil.ReadFile(file)
+}
+
+// importFile loads the rules of a grammar file into the grammar. The path is relative to the
+// importing file. With a namespace, the rules are named like `namespace.rule`, otherwise they are
+// merged as is. Imported rules are never root rules, and only the @import directives of an
+// imported file are applied. A file imported again with the same namespace is ignored.
+func (inst *Grammar) importFile(file string, namespace string) error {
+	parent := inst.loading
+	if parent == nil {
+		parent = &loadContext{}
+	}
+	path := inst.resolve(parent.file, file)
+	context := &loadContext{file: path, namespace: parent.namespace, parent: parent}
+	if namespace != "" {
+		context.namespace = parent.qualify(namespace)
+	}
+	chain := []string{path}
+	for ctx := parent; ctx != nil; ctx = ctx.parent {
+		if ctx.file == "" {
+			continue
+		}
+		chain = append([]string{ctx.file}, chain...)
+		if ctx.file == path {
+			return fmt.Errorf("import cycle: %s", strings.Join(chain, " -> "))
+		}
+	}
+	key := path + "|" + context.namespace
+	if inst.imported[key] {
+		return nil
+	}
+	text, err := inst.readFile(path)
+	if err != nil {
+		return fmt.Errorf("can't read file: %s", err)
+	}
+	if inst.imported == nil {
+		inst.imported = make(map[string]bool)
+	}
+	inst.imported[key] = true
+	maxLine := inst.maxLine
+	inst.maxLine = 0
+	defer func() { inst.maxLine = maxLine }()
+	if err := inst.load(string(text), context); err != nil {
+		return fmt.Errorf("%s: %s", path, err)
+	}
+	return nil
+}
+
+// validateRuleRef checks a rule name used in a directive, which may be qualified by namespaces
+func validateRuleRef(ruleName string) (string, error) {
+	for _, name := range strings.Split(ruleName, string(NamespaceSymbol)) {
+		if _, err := validateRuleName(name); err != nil {
+			return "", err
+		}
+	}
+	return ruleName, nil
+}
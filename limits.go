@@ -0,0 +1,123 @@
+package xbnf
+
+import (
+	"context"
+	"fmt"
+)
+
+// the context is checked once every so many checks of the limits
+const contextCheckInterval = 64
+
+// Limits bounds the resources an evaluation of a text may use, so a hostile input can't make it
+// run for long or overflow the stack. A zero field means no limit.
+type Limits struct {
+	MaxDepth       int // max # of named rules in evaluation at the same time, ie. nested
+	MaxEvaluations int // max # of evaluations of named rules, memo hits included
+	MaxInputLength int // max # of chars of the input
+}
+
+// DepthLimitError stops an evaluation when the named rules nest deeper than Limits.MaxDepth
+type DepthLimitError struct {
+	Limit  int
+	Rule   string // the rule that would go over the limit
+	Cursor int
+}
+
+func (inst *DepthLimitError) Error() string {
+	return fmt.Sprintf("depth limit %d exceeded by rule %s at cursor %d", inst.Limit, inst.Rule, inst.Cursor)
+}
+
+// EvaluationLimitError stops an evaluation when the named rules are evaluated more times than
+// Limits.MaxEvaluations
+type EvaluationLimitError struct {
+	Limit  int
+	Cursor int
+}
+
+func (inst *EvaluationLimitError) Error() string {
+	return fmt.Sprintf("evaluation limit %d exceeded at cursor %d", inst.Limit, inst.Cursor)
+}
+
+// InputLimitError stops an evaluation when the input is longer than Limits.MaxInputLength chars
+type InputLimitError struct {
+	Limit int
+}
+
+func (inst *InputLimitError) Error() string {
+	return fmt.Sprintf("input longer than %d chars", inst.Limit)
+}
+
+// SetLimits sets the limits of the evaluations of texts, see Limits. The limits of a Parser are
+// the ones of the grammar when it's compiled.
+func (inst *Grammar) SetLimits(limits Limits) {
+	inst.limits = limits
+}
+
+// checkLimits stops the evaluation when the context is done or a limit is exceeded, the error is
+// kept and returned by all checks afterwards. The record is the rule about to be evaluated, nil if
+// the check is made in a loop rather than for a rule.
+func (inst *Grammar) checkLimits(charstream ICharstream, record *RuleRecord) error {
+	state := inst.state
+	if state == nil {
+		return nil
+	}
+	if state.abort != nil {
+		return state.abort
+	}
+	if state.ctx != nil && state.checks%contextCheckInterval == 0 {
+		if err := state.ctx.Err(); err != nil {
+			state.abort = err
+			return err
+		}
+	}
+	state.checks++
+	limits := inst.limits
+	if limits.MaxInputLength > 0 && charstream.Cursor() > limits.MaxInputLength {
+		state.abort = &InputLimitError{Limit: limits.MaxInputLength}
+	} else if record != nil {
+		state.evaluations++
+		if limits.MaxEvaluations > 0 && state.evaluations > limits.MaxEvaluations {
+			state.abort = &EvaluationLimitError{Limit: limits.MaxEvaluations, Cursor: charstream.Cursor()}
+		} else if limits.MaxDepth > 0 && len(state.stack) >= limits.MaxDepth {
+			state.abort = &DepthLimitError{Limit: limits.MaxDepth, Rule: record.name, Cursor: charstream.Cursor()}
+		}
+	}
+	return state.abort
+}
+
+// EvalContext is the same as Eval, except the evaluation stops with the error of the context
+// when the context is canceled or its deadline is exceeded.
+func (inst *Grammar) EvalContext(ctx context.Context, charstream ICharstream, simplifyLevel int) (*AST, error) {
+	ast, _, err := inst.evalRaw(ctx, charstream, inst.topRules(), false)
+	if err != nil {
+		return nil, err
+	}
+	simplify(ast, simplifyLevel)
+	return ast, nil
+}
+
+// EvalFromContext is the same as EvalFrom, except it stops when the context is done, see
+// EvalContext.
+func (inst *Grammar) EvalFromContext(ctx context.Context, ruleName string, charstream ICharstream, simplifyLevel int) (*AST, error) {
+	record := inst.GetRecord(ruleName)
+	if record == nil {
+		return nil, fmt.Errorf("rule '%s' not defined", ruleName)
+	}
+	ast, _, err := inst.evalRaw(ctx, charstream, map[string]*RuleRecord{ruleName: record}, false)
+	if err != nil {
+		return nil, err
+	}
+	simplify(ast, simplifyLevel)
+	return ast, nil
+}
+
+// EvalWithRecoveryContext is the same as EvalWithRecovery, except it stops when the context is
+// done, see EvalContext. A failure recovered doesn't stop the evaluation, but a limit exceeded does.
+func (inst *Grammar) EvalWithRecoveryContext(ctx context.Context, charstream ICharstream, simplifyLevel int) (*AST, []*ParseError, error) {
+	ast, diagnostics, err := inst.evalRaw(ctx, charstream, inst.topRules(), true)
+	if err != nil {
+		return nil, diagnostics, err
+	}
+	simplify(ast, simplifyLevel)
+	return ast, diagnostics, nil
+}
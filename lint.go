@@ -0,0 +1,214 @@
+package xbnf
+
+import (
+	"fmt"
+	"sort"
+	"strings"
+)
+
+// LintIssue is a likely mistake in a grammar found by Lint
+type LintIssue struct {
+	Rule    string // name of the rule having the issue
+	File    string // file defining the rule, if available
+	Line    int    // line defining the rule
+	Message string
+}
+
+func (inst *LintIssue) String() string {
+	if inst.File == "" {
+		return fmt.Sprintf("L#%d: rule [%s] - %s", inst.Line, inst.Rule, inst.Message)
+	}
+	return fmt.Sprintf("%s: L#%d: rule [%s] - %s", inst.File, inst.Line, inst.Rule, inst.Message)
+}
+
+// Lint validates the grammar and reports the rules that are valid but unlikely to work as
+// intended:
+//   - rules unreachable from the top rules, see SetStartRule
+//   - repetitions of a rule that can match empty, which stop without using any char
+//   - repetition specifications like <0,0> or <1,1>
+//   - duplicate alternatives of a choice
+//   - alternatives shadowed by an alternative in an earlier ordered group
+//   - ambiguous alternatives, see Ambiguities
+//   - block rules whose close can never match, as it's excluded
+//
+// The issues are sorted by file and line.
+func (inst *Grammar) Lint() ([]*LintIssue, error) {
+	if err := inst.Validate(); err != nil {
+		return nil, err
+	}
+	var issues []*LintIssue
+	nullables := inst.nullableRules()
+	reachable := inst.reachableRules()
+	for name, record := range inst.ruleRecords {
+		report := func(format string, args ...interface{}) {
+			issues = append(issues, &LintIssue{
+				Rule:    name,
+				File:    record.file,
+				Line:    record.line,
+				Message: fmt.Sprintf(format, args...),
+			})
+		}
+		if !reachable[name] && !record.imported {
+			if inst.startRule != "" {
+				report("unreachable from the start rule %s", inst.startRule)
+			} else {
+				report("unreachable from the root rules")
+			}
+		}
+		walkRule(record.rule, func(rule IRule) {
+			switch r := rule.(type) {
+			case *RepetitionRule:
+				if nullable(r.rule, nullables) {
+					report("repetition of %s can match empty", r.rule.String())
+				}
+				if r.explicit && r.min == 0 && r.max == 0 {
+					report("repetition spec <0,0> means 0 or more times, use { } instead")
+				} else if r.explicit && r.min == 1 && r.max == 1 {
+					report("repetition spec <1,1> repeats once only")
+				}
+			case *ChoiceRule:
+				lintChoice(r, nullables, report)
+			case *BlockRule:
+				if excluded := inst.blockCloseExcluded(r); excluded != nil {
+					report("block close %s can never match, it's excluded by %s", r.close.String(), excluded.String())
+				}
+			}
+		})
+	}
+	ambiguities, err := inst.Ambiguities()
+	if err != nil {
+		return nil, err
+	}
+	for _, ambiguity := range ambiguities {
+		first, second := ambiguity.First.String(), ambiguity.Second.String()
+		if first == second {
+			continue // reported as duplicate
+		}
+		issues = append(issues, &LintIssue{
+			Rule:    ambiguity.Rule,
+			File:    ambiguity.File,
+			Line:    ambiguity.Line,
+			Message: fmt.Sprintf("alternatives %s and %s are ambiguous, both match %q", first, second, ambiguity.Witness),
+		})
+	}
+	sort.Slice(issues, func(i, j int) bool {
+		if issues[i].File != issues[j].File {
+			return issues[i].File < issues[j].File
+		}
+		if issues[i].Line != issues[j].Line {
+			return issues[i].Line < issues[j].Line
+		}
+		return issues[i].Message < issues[j].Message
+	})
+	return issues, nil
+}
+
+// reachableRules finds the rules evaluated directly or indirectly by the top rules, the skip rule
+// or the sync rules.
+func (inst *Grammar) reachableRules() map[string]bool {
+	reachable := make(map[string]bool)
+	var todo []string
+	for name := range inst.topRules() {
+		todo = append(todo, name)
+	}
+	todo = append(todo, inst.syncRules...)
+	if inst.skipRule != "" {
+		todo = append(todo, inst.skipRule)
+	}
+	for len(todo) > 0 {
+		name := todo[len(todo)-1]
+		todo = todo[:len(todo)-1]
+		record := inst.ruleRecords[name]
+		if reachable[name] || record == nil {
+			continue
+		}
+		reachable[name] = true
+		walkRule(record.rule, func(rule IRule) {
+			if ref, ok := rule.(*ReferenceRule); ok {
+				todo = append(todo, ref.refName)
+			}
+		})
+	}
+	return reachable
+}
+
+// lintChoice reports the duplicate and the shadowed alternatives of a choice.
+func lintChoice(choice *ChoiceRule, nullables map[string]bool, report func(format string, args ...interface{})) {
+	seen := make(map[string]bool)
+	var earlier []IRule // alternatives in the earlier groups
+	for _, group := range choice.groups {
+		for _, alt := range group {
+			str := alt.String()
+			if seen[str] {
+				report("duplicate alternative %s", str)
+				continue
+			}
+			seen[str] = true
+			for _, prior := range earlier {
+				if shadows(prior, alt, nullables) {
+					report("alternative %s is shadowed by %s in an earlier group", str, prior.String())
+					break
+				}
+			}
+		}
+		earlier = append(earlier, group...)
+	}
+}
+
+// shadows checks whether a match of the prior alternative is found wherever the alt matches,
+// ie. the prior matches empty, or it's a literal and a prefix of the literal alt.
+func shadows(prior IRule, alt IRule, nullables map[string]bool) bool {
+	switch prior.(type) {
+	case *EOFRule, *PredicateRule: // they may fail without using any char
+	default:
+		if nullable(prior, nullables) {
+			return true
+		}
+	}
+	priorText, priorFold, ok := literalText(prior)
+	if !ok {
+		return false
+	}
+	altText, altFold, ok := literalText(alt)
+	if !ok || priorFold != altFold {
+		return false
+	}
+	if priorFold {
+		return strings.HasPrefix(strings.ToLower(altText), strings.ToLower(priorText))
+	}
+	return strings.HasPrefix(altText, priorText)
+}
+
+// literalText returns the text of a literal rule, and whether it's case-insensitive
+func literalText(rule IRule) (string, bool, bool) {
+	switch r := rule.(type) {
+	case *TerminalStringRule:
+		return string(r.text), r.caseInsensitive, true
+	case *TerminalCharsRule:
+		return string(r.text), r.caseInsensitive, true
+	case *TerminalCharRule:
+		return string(r.text), r.caseInsensitive, true
+	case *GroupRule:
+		return literalText(r.rule)
+	}
+	return "", false, false
+}
+
+// blockCloseExcluded returns the exclude of the block matching its close, if the close is a
+// literal. The excludes are checked before the close, so such a close never matches.
+func (inst *Grammar) blockCloseExcluded(block *BlockRule) IRule {
+	text, _, ok := literalText(block.close)
+	if !ok || text == "" {
+		return nil
+	}
+	defer inst.beginEval()()
+	inst.silence(true)
+	defer inst.silence(false)
+	for _, exclude := range block.excludes {
+		result := exclude.Eval(inst, NewCharstreamFromString(text), NOT_SKIP)
+		if result.Node != nil {
+			return exclude
+		}
+	}
+	return nil
+}
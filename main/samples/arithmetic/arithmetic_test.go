@@ -21,8 +21,7 @@ func evalRule(t *testing.T, grammar *xbnf.Grammar, ruleName string, sample strin
 	t.Logf("====> RULE  : %s = %s", ruleName, rule.String())
 	cs := xbnf.NewCharstreamFromString(sample)
 	result := rule.Eval(grammar, cs, xbnf.SUGGEST_SKIP)
-	t.Logf("CharsRead:%s*", string(result.CharsRead))
-	t.Logf("CharsUnused:%s*", string(result.CharsUnused))
+	t.Logf("Start:%d, End:%d", result.Start, result.End)
 	if result.Node == nil {
 		if expected == "" {
 			t.Logf("====> Passed")
@@ -54,8 +53,7 @@ func evalRuleCS(t *testing.T, grammar *xbnf.Grammar, ruleName string, cs xbnf.IC
 	rule := record.Rule()
 	t.Logf("====> RULE  : %s = %s", ruleName, rule.String())
 	result := rule.Eval(grammar, cs, xbnf.SUGGEST_SKIP)
-	t.Logf("CharsRead:%s*", string(result.CharsRead))
-	t.Logf("CharsUnused:%s*", string(result.CharsUnused))
+	t.Logf("Start:%d, End:%d", result.Start, result.End)
 	if result.Node == nil {
 		if expected == "" {
 			t.Logf("====> Passed")
@@ -219,3 +217,27 @@ func TestMain(t *testing.T) {
 		tester(t, g, "sample3")
 	})
 }
+
+func BenchmarkArithmetic(b *testing.B) {
+	g, err := xbnf.NewGrammarFromFile("arithmetic.xbnf")
+	if err != nil {
+		b.Fatalf("Failed: invalid xbnf file: %s", err)
+	}
+	var samples []string
+	for _, sampleFile := range []string{"sample1.txt", "sample2.txt", "sample3.txt"} {
+		sample, err := ioutil.ReadFile(sampleFile)
+		if err != nil {
+			b.Fatalf("Failed: can't real file: %s", err)
+		}
+		samples = append(samples, string(sample))
+	}
+	b.ResetTimer()
+	for i := 0; i < b.N; i++ {
+		for _, sample := range samples {
+			_, err := g.Eval(xbnf.NewCharstreamFromString(sample), xbnf.LevelBasic)
+			if err != nil {
+				b.Fatalf("Failed: %s", err)
+			}
+		}
+	}
+}
@@ -1,13 +1,20 @@
 package json_test
 
 import (
+	"embed"
 	"fmt"
+	"io/fs"
 	"io/ioutil"
+	"os"
 	"testing"
+	"testing/fstest"
 
 	"github.com/cnsgfk/xbnf"
 )
 
+//go:embed json.xbnf
+var embedded embed.FS
+
 func TestJson(t *testing.T) {
 	tester := func(t *testing.T, grammar *xbnf.Grammar, sampleName string) {
 		t.Logf("====> Sample: %s", sampleName)
@@ -115,3 +122,158 @@ func TestNondata(t *testing.T) {
 		tester(t, g, "sample3")
 	})
 }
+
+func TestJsonReader(t *testing.T) {
+	tester := func(t *testing.T, grammar *xbnf.Grammar, sampleName string) {
+		sampleFile := sampleName + ".json"
+		outputFile := sampleName + ".output"
+		output, err := ioutil.ReadFile(outputFile)
+		if err != nil {
+			t.Errorf("Failed: %s", fmt.Errorf("can't real file: %s", err))
+			return
+		}
+		charstream, err := xbnf.NewCharstreamFromFile(sampleFile)
+		if err != nil {
+			t.Errorf("Failed: %s", err)
+			return
+		}
+		defer charstream.Close()
+		charstream.SetWindow(16)
+		ast, err := grammar.Eval(charstream, xbnf.LevelRaw)
+		if err != nil {
+			t.Errorf("Failed: %s", err)
+			return
+		}
+		ast.MergeStickyNodes()
+		ast.RemoveVirtualNodes()
+		ast.RemoveRedundantNodes()
+		text := ast.Text()
+		if string(text) != string(output) {
+			t.Logf("Expected Output: \n%s", string(output))
+			t.Errorf("Failed: unexpect output\n%s", string(text))
+			return
+		}
+		t.Logf("Passed: actual output\n%s", string(text))
+	}
+	g, err := xbnf.NewGrammarFromFile("json.xbnf")
+	if err != nil {
+		t.Errorf("Failed: invalid xbnf file: %s", err)
+		return
+	}
+	t.Run("sample1", func(t *testing.T) {
+		tester(t, g, "sample1")
+	})
+	t.Run("sample2", func(t *testing.T) {
+		tester(t, g, "sample2")
+	})
+	t.Run("sample3", func(t *testing.T) {
+		tester(t, g, "sample3")
+	})
+}
+
+func TestJsonFS(t *testing.T) {
+	tester := func(t *testing.T, fsys fs.FS, file string) {
+		g, err := xbnf.NewGrammarFromFS(fsys, file)
+		if err != nil {
+			t.Errorf("Failed: invalid xbnf file: %s", err)
+			return
+		}
+		ast, err := g.Eval(xbnf.NewCharstreamFromString(`{"a": [1, true, null]}`), xbnf.LevelRaw)
+		if err != nil {
+			t.Errorf("Failed: %s", err)
+			return
+		}
+		if ast.Filename != file {
+			t.Errorf("Failed: expect AST file %s, got %s", file, ast.Filename)
+			return
+		}
+		t.Logf("Passed: %s", ast.Filename)
+	}
+	xbnfText, err := ioutil.ReadFile("json.xbnf")
+	if err != nil {
+		t.Errorf("Failed: %s", fmt.Errorf("can't real file: %s", err))
+		return
+	}
+	t.Run("t1.embed", func(t *testing.T) {
+		tester(t, embedded, "json.xbnf")
+	})
+	t.Run("t2.dirfs", func(t *testing.T) {
+		tester(t, os.DirFS("."), "json.xbnf")
+	})
+	t.Run("t3.mapfs", func(t *testing.T) {
+		fsys := fstest.MapFS{
+			"grammars/json.xbnf":   {Data: xbnfText},
+			"grammars/config.xbnf": {Data: []byte("@import json.xbnf as json\nconfig = json.object\n")},
+		}
+		tester(t, fsys, "grammars/config.xbnf")
+		_, err := xbnf.NewGrammarFromFS(fsys, "grammars/missing.xbnf")
+		if err == nil {
+			t.Errorf("Failed: expect error for a missing file")
+			return
+		}
+		t.Logf("Passed: %s", err)
+	})
+}
+
+func TestJsonDispatch(t *testing.T) {
+	g, err := xbnf.NewGrammarFromFile("json.xbnf")
+	if err != nil {
+		t.Errorf("Failed: invalid xbnf file: %s", err)
+		return
+	}
+	for _, sampleFile := range []string{"sample1.json", "sample2.json", "sample3.json"} {
+		sample, err := ioutil.ReadFile(sampleFile)
+		if err != nil {
+			t.Errorf("Failed: can't real file: %s", err)
+			return
+		}
+		var trees []string
+		for _, dispatch := range []bool{false, true} {
+			g.SetDispatch(dispatch)
+			ast, err := g.Eval(xbnf.NewCharstreamFromString(string(sample)), xbnf.LevelRaw)
+			if err != nil {
+				t.Errorf("Failed: %s", err)
+				return
+			}
+			trees = append(trees, ast.StringTree(nil))
+		}
+		if trees[0] != trees[1] {
+			t.Errorf("Failed: %s - the ASTs with and without dispatch are different", sampleFile)
+			continue
+		}
+		t.Logf("====> Passed: %s", sampleFile)
+	}
+}
+
+func BenchmarkJson(b *testing.B) {
+	benchmarkJson(b, true)
+}
+
+func BenchmarkJsonNoDispatch(b *testing.B) {
+	benchmarkJson(b, false)
+}
+
+func benchmarkJson(b *testing.B, dispatch bool) {
+	g, err := xbnf.NewGrammarFromFile("json.xbnf")
+	if err != nil {
+		b.Fatalf("Failed: invalid xbnf file: %s", err)
+	}
+	g.SetDispatch(dispatch)
+	var samples []string
+	for _, sampleFile := range []string{"sample1.json", "sample2.json", "sample3.json"} {
+		sample, err := ioutil.ReadFile(sampleFile)
+		if err != nil {
+			b.Fatalf("Failed: can't real file: %s", err)
+		}
+		samples = append(samples, string(sample))
+	}
+	b.ResetTimer()
+	for i := 0; i < b.N; i++ {
+		for _, sample := range samples {
+			_, err := g.Eval(xbnf.NewCharstreamFromString(sample), xbnf.LevelRaw)
+			if err != nil {
+				b.Fatalf("Failed: %s", err)
+			}
+		}
+	}
+}
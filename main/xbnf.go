@@ -3,7 +3,6 @@ package main
 import (
 	"flag"
 	"fmt"
-	"io/ioutil"
 	"os"
 	"strings"
 
@@ -11,10 +10,19 @@ import (
 )
 
 func main() {
+	if len(os.Args) > 1 && os.Args[1] == "lint" {
+		os.Exit(lint(os.Args[2:]))
+	}
+	if len(os.Args) > 1 && os.Args[1] == "profile" {
+		os.Exit(profile(os.Args[2:]))
+	}
 	// process command line arguments
 	ruleFile := flag.String("xbnf", "", "Optional - The XBNF file with a set of rules to be added to the grammar")
 	treeNodeType := flag.Bool("showNodeType", false, "Show node type in the AST tree")
 	help := flag.Bool("help", false, "Print help message")
+	color := flag.Bool("color", false, "Colour the parse errors with ANSI escape codes")
+	startRule := flag.String("start", "", "Optional - The rule to parse the texts, instead of the root rules")
+	trace := flag.Bool("trace", false, "Print the evaluation trace of the named rules while parsing")
 	var rules multi
 	flag.Var(&rules, "rule", "Optional - Add a rule in the grammar. ")
 	var texts multi
@@ -57,14 +65,23 @@ func main() {
 		}
 	}
 
+	if *startRule != "" {
+		grammar.SetStartRule(*startRule)
+	}
+	// an unknown start rule is reported here, rather than falling back to the root rules
 	err := grammar.Validate()
 	if err != nil {
 		fmt.Printf("ERROR: %s\n", err)
+		os.Exit(1)
 	}
 	grammarStr := grammar.Serialize(false)
 	grammarStr = strings.ReplaceAll(grammarStr, "\n", "\n    ")
 	fmt.Printf("Grammar:\n    %s", grammarStr)
 
+	if *trace {
+		grammar.SetTracer(xbnf.NewTextTracer(os.Stdout))
+	}
+
 	treeConf := xbnf.DefaultNodeTreeConfig()
 	treeConf.PrintRuleType = *treeNodeType
 
@@ -73,7 +90,7 @@ func main() {
 		cs := xbnf.NewCharstreamFromString(text)
 		ast, err := grammar.Eval(cs, xbnf.LevelBasic)
 		if err != nil {
-			fmt.Printf("ERROR: %s", err)
+			fmt.Print(xbnf.RenderError(err, "", *color))
 			return
 		}
 		ast.RemoveVirtualNodes()
@@ -84,15 +101,18 @@ func main() {
 
 	for _, textfile := range textFiles {
 		fmt.Printf("\nParsing file: %s\n", textfile)
-		text, err := ioutil.ReadFile(textfile)
+		cs, err := xbnf.NewCharstreamFromFile(textfile)
 		if err != nil {
 			fmt.Printf("ERROR: %s", err)
 			return
 		}
-		cs := xbnf.NewCharstreamFromString(string(text))
 		ast, err := grammar.Eval(cs, xbnf.LevelBasic)
+		cs.Close()
+		if err == nil {
+			err = cs.Err()
+		}
 		if err != nil {
-			fmt.Printf("ERROR: %s", err)
+			fmt.Print(xbnf.RenderError(err, textfile, *color))
 			return
 		}
 		ast.RemoveVirtualNodes()
@@ -105,6 +125,104 @@ func main() {
 
 func printHelp() {
 	flag.CommandLine.Usage()
+	fmt.Fprintf(flag.CommandLine.Output(), "Commands:\n  lint\n    \tReport likely mistakes in XBNF files, see 'xbnf lint -help'\n")
+	fmt.Fprintf(flag.CommandLine.Output(), "  profile\n    \tReport the time spent in each rule parsing files, see 'xbnf profile -help'\n")
+}
+
+// lint prints the issues found in the XBNF files, returns the exit code which is 1 if any issue or
+// error found.
+func lint(args []string) int {
+	flags := flag.NewFlagSet("lint", flag.ExitOnError)
+	startRule := flags.String("start", "", "Optional - The rule to parse the texts, instead of the root rules")
+	flags.Usage = func() {
+		fmt.Fprintf(flags.Output(), "Usage: xbnf lint [-start rule] file.xbnf ...\n")
+		flags.PrintDefaults()
+	}
+	flags.Parse(args)
+	if flags.NArg() == 0 {
+		flags.Usage()
+		return 2
+	}
+	code := 0
+	for _, file := range flags.Args() {
+		grammar, err := xbnf.NewGrammarFromFile(file)
+		if err != nil {
+			fmt.Printf("ERROR: %s\n", err)
+			code = 1
+			continue
+		}
+		if *startRule != "" {
+			grammar.SetStartRule(*startRule)
+			if err := grammar.Validate(); err != nil {
+				fmt.Printf("ERROR: %s: %s\n", file, err)
+				code = 1
+				continue
+			}
+		}
+		issues, err := grammar.Lint()
+		if err != nil {
+			fmt.Printf("ERROR: %s: %s\n", file, err)
+			code = 1
+			continue
+		}
+		for _, issue := range issues {
+			fmt.Println(issue)
+			code = 1
+		}
+	}
+	return code
+}
+
+// profile parses the files with a grammar and prints the profiles of the rules, returns the exit
+// code which is 1 if any file can't be parsed.
+func profile(args []string) int {
+	flags := flag.NewFlagSet("profile", flag.ExitOnError)
+	ruleFile := flags.String("xbnf", "", "The XBNF file of the grammar to parse the files with")
+	startRule := flags.String("start", "", "Optional - The rule to parse the files, instead of the root rules")
+	top := flags.Int("top", 0, "Optional - Print the slowest rules only, 0 means all")
+	flags.Usage = func() {
+		fmt.Fprintf(flags.Output(), "Usage: xbnf profile -xbnf grammar.xbnf [-start rule] [-top n] file ...\n")
+		flags.PrintDefaults()
+	}
+	flags.Parse(args)
+	if *ruleFile == "" || flags.NArg() == 0 {
+		flags.Usage()
+		return 2
+	}
+	grammar, err := xbnf.NewGrammarFromFile(*ruleFile)
+	if err != nil {
+		fmt.Printf("ERROR: %s\n", err)
+		return 1
+	}
+	if *startRule != "" {
+		grammar.SetStartRule(*startRule)
+		if err := grammar.Validate(); err != nil {
+			fmt.Printf("ERROR: %s\n", err)
+			return 1
+		}
+	}
+	profiler := xbnf.NewProfiler()
+	grammar.SetProfiler(profiler)
+	code := 0
+	for _, file := range flags.Args() {
+		cs, err := xbnf.NewCharstreamFromFile(file)
+		if err != nil {
+			fmt.Printf("ERROR: %s\n", err)
+			code = 1
+			continue
+		}
+		_, err = grammar.Eval(cs, xbnf.LevelBasic)
+		cs.Close()
+		if err == nil {
+			err = cs.Err()
+		}
+		if err != nil {
+			fmt.Print(xbnf.RenderError(err, file, false))
+			code = 1
+		}
+	}
+	profiler.WriteTable(os.Stdout, *top)
+	return code
 }
 
 type multi []string
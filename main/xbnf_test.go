@@ -13,3 +13,36 @@ func TestMain(t *testing.T) {
 	os.Args = append(os.Args, "../samples/dgen/sample1.0.dgen")
 	main()
 }
+
+func TestLint(t *testing.T) {
+	if code := lint([]string{"samples/json/json.xbnf", "samples/arithmetic/arithmetic.xbnf"}); code != 0 {
+		t.Errorf("Failed: expect no issue in the samples, got exit code %d", code)
+		return
+	}
+	if code := lint([]string{"samples/missing.xbnf"}); code != 1 {
+		t.Errorf("Failed: expect exit code 1 for a missing file, got %d", code)
+		return
+	}
+	if code := lint([]string{"-start", "vaule", "samples/json/json.xbnf"}); code != 1 {
+		t.Errorf("Failed: expect exit code 1 for an unknown start rule, got %d", code)
+		return
+	}
+	t.Logf("====> Passed")
+}
+
+func TestProfile(t *testing.T) {
+	json := []string{"-xbnf", "samples/json/json.xbnf", "-top", "5", "samples/json/sample1.json", "samples/json/sample2.json"}
+	if code := profile(json); code != 0 {
+		t.Errorf("Failed: expect the samples parsed, got exit code %d", code)
+		return
+	}
+	if code := profile([]string{"-xbnf", "samples/json/json.xbnf", "samples/missing.json"}); code != 1 {
+		t.Errorf("Failed: expect exit code 1 for a missing file, got %d", code)
+		return
+	}
+	if code := profile([]string{"-xbnf", "samples/json/json.xbnf", "-start", "vaule", "samples/json/sample1.json"}); code != 1 {
+		t.Errorf("Failed: expect exit code 1 for an unknown start rule, got %d", code)
+		return
+	}
+	t.Logf("====> Passed")
+}
@@ -0,0 +1,253 @@
+package xbnf
+
+import (
+	"context"
+	"fmt"
+)
+
+// MemoStats reports how effective the memo table of a Grammar is.
+type MemoStats struct {
+	Hits      int // # of rule evaluations answered by the memo table
+	Misses    int // # of rule evaluations not found in the memo table
+	Evictions int // # of results dropped because the memo table is full
+}
+
+// HitRate returns the ratio of hits in all memo table lookups, 0 if there is no lookup.
+func (inst MemoStats) HitRate() float64 {
+	total := inst.Hits + inst.Misses
+	if total == 0 {
+		return 0
+	}
+	return float64(inst.Hits) / float64(total)
+}
+
+// A rule evaluation result only depends on the rule, the cursor where the evaluation starts
+// and how the leading spaces are handled
+type memoKey struct {
+	record *RuleRecord
+	cursor int
+	flag   int
+}
+
+// memoTable caches the EvalResult of named rules during one evaluation of a charstream
+type memoTable struct {
+	maxEntries int // 0 means unlimited
+	entries    map[memoKey]*EvalResult
+	stats      *MemoStats
+}
+
+func newMemoTable(maxEntries int, stats *MemoStats) *memoTable {
+	return &memoTable{
+		maxEntries: maxEntries,
+		entries:    make(map[memoKey]*EvalResult),
+		stats:      stats,
+	}
+}
+
+// get returns a copy of the cached result, so the caller is free to change the result. Return
+// nil if there is no cached result.
+func (inst *memoTable) get(key memoKey) *EvalResult {
+	cached, exists := inst.entries[key]
+	if !exists {
+		inst.stats.Misses++
+		return nil
+	}
+	inst.stats.Hits++
+	result := *cached
+	return &result
+}
+
+// put saves a copy of the result. When the table is full, all entries are dropped, the
+// table is meant to speed up backtracking near the cursor, the old entries are less likely
+// to be used again.
+func (inst *memoTable) put(key memoKey, result *EvalResult) {
+	if inst.maxEntries > 0 && len(inst.entries) >= inst.maxEntries {
+		inst.stats.Evictions = inst.stats.Evictions + len(inst.entries)
+		inst.entries = make(map[memoKey]*EvalResult)
+	}
+	cached := *result
+	inst.entries[key] = &cached
+}
+
+// evalState holds the states of one evaluation of a charstream
+type evalState struct {
+	memo      *memoTable
+	lr        *leftRecursion
+	seeds     map[memoKey]*seed // results of the left-recursive rules in evaluation
+	seedReads int               // # of times a seed is used
+	stack     []string          // names of the rules in evaluation, the outermost first
+	failure   failure           // the furthest failure
+	silent    int               // failures are not recorded if it's greater than 0
+	skipping  bool              // the skip rule is in evaluation
+	skipped   skipped           // the last skip, the alternatives of a choice skip at the same cursor
+	recovery  bool              // failed repetition elements are skipped, see EvalWithRecovery
+
+	ctx         context.Context // stops the evaluation when it's done, may be nil
+	checks      int             // # of times the limits are checked
+	evaluations int             // # of evaluations of named rules
+	abort       error           // the reason the evaluation is stopped, see checkLimits
+
+	profiles map[string]*ruleProfiling // profiles of the rules, nil if not profiling
+}
+
+// skipped is where a skip of the skip rule starts and ends in a charstream
+type skipped struct {
+	charstream ICharstream
+	start      int
+	end        int
+	spaces     []rune // the white spaces right before the end
+}
+
+// seed is the result of a left-recursive rule to be used when the rule is evaluated again at
+// the same cursor
+type seed struct {
+	result *EvalResult
+	reads  int
+}
+
+// EnableMemo turns on the packrat memoization: the result of a named rule evaluated at a
+// cursor is cached, so each rule is evaluated at most once per position in the stream. The
+// maxEntries bounds the # of results kept in memory, 0 means unlimited. Enabling memo
+// resets MemoStats.
+func (inst *Grammar) EnableMemo(maxEntries int) {
+	inst.memoEnabled = true
+	inst.memoMaxEntries = maxEntries
+	inst.memoStats = MemoStats{}
+}
+
+func (inst *Grammar) DisableMemo() {
+	inst.memoEnabled = false
+}
+
+// MemoStats returns the memo statistics accumulated since the memo is enabled
+func (inst *Grammar) MemoStats() MemoStats {
+	return inst.memoStats
+}
+
+// beginEval prepares the states for an evaluation of a charstream, the returned function
+// must be called when the evaluation is done.
+func (inst *Grammar) beginEval() func() {
+	state := &evalState{
+		lr:    inst.leftRecursion(),
+		seeds: make(map[memoKey]*seed),
+	}
+	state.failure.cursor = -1
+	if inst.memoEnabled {
+		state.memo = newMemoTable(inst.memoMaxEntries, &inst.memoStats)
+	}
+	if inst.profiler != nil {
+		state.profiles = make(map[string]*ruleProfiling)
+	}
+	inst.state = state
+	return func() {
+		if state.profiles != nil {
+			inst.profiler.merge(state.profiles)
+		}
+		inst.state = nil
+	}
+}
+
+// evalRecord evaluates a named rule, consulting the memo table if there is one, and handles
+// left recursion.
+func (inst *Grammar) evalRecord(record *RuleRecord, charstream ICharstream, flagLeadingSpaces int) *EvalResult {
+	if inst.state == nil {
+		// the rule is evaluated directly rather than by one of the Eval methods of the grammar
+		defer inst.beginEval()()
+	}
+	state := inst.state
+	if err := inst.checkLimits(charstream, record); err != nil {
+		cursor := charstream.Cursor()
+		return &EvalResult{Start: cursor, End: cursor, ErrIdx: cursor, Error: err}
+	}
+	state.stack = append(state.stack, record.name)
+	var result *EvalResult
+	switch {
+	case state.profiles != nil:
+		result = inst.profileRecord(state, record, charstream, flagLeadingSpaces)
+	case inst.tracer != nil:
+		result = inst.traceRecord(state, record, charstream, flagLeadingSpaces)
+	default:
+		result = inst.evalStacked(state, record, charstream, flagLeadingSpaces)
+	}
+	state.stack = state.stack[:len(state.stack)-1]
+	return result
+}
+
+// evalStacked evaluates a named rule that is pushed on the rule stack
+func (inst *Grammar) evalStacked(state *evalState, record *RuleRecord, charstream ICharstream, flagLeadingSpaces int) *EvalResult {
+	recursive := state.lr.rules[record.name]
+	if !recursive && state.memo == nil {
+		return record.rule.Eval(inst, charstream, flagLeadingSpaces)
+	}
+	key := memoKey{record: record, cursor: charstream.Cursor(), flag: flagLeadingSpaces}
+	if entry, exists := state.seeds[key]; exists {
+		// the rule is evaluated again at the same cursor, ie. left recursion
+		entry.reads++
+		state.seedReads++
+		result := *entry.result
+		charstream.Seek(result.End)
+		return &result
+	}
+	if state.memo != nil {
+		result := state.memo.get(key)
+		if result != nil {
+			// the stream must end up where the evaluation would leave it
+			charstream.Seek(result.End)
+			return result
+		}
+	}
+	seedReads := state.seedReads
+	var result *EvalResult
+	switch {
+	case !recursive:
+		result = record.rule.Eval(inst, charstream, flagLeadingSpaces)
+	case inst.noLeftRecursion:
+		// left recursion is not supported, evaluating the rule again at the cursor fails
+		entry := &seed{result: &EvalResult{Start: key.cursor, End: key.cursor, ErrIdx: key.cursor,
+			Error: fmt.Errorf("rule %s: left recursion is not supported", record.name)}}
+		state.seeds[key] = entry
+		result = record.rule.Eval(inst, charstream, flagLeadingSpaces)
+		delete(state.seeds, key)
+		state.seedReads = state.seedReads - entry.reads
+	case state.lr.leaders[record.name]:
+		result = inst.growRecord(key, charstream)
+	default:
+		// other rules in the left-recursive cycle, the leader of the cycle takes care of it
+		result = record.rule.Eval(inst, charstream, flagLeadingSpaces)
+	}
+	if state.memo != nil && state.seedReads == seedReads && state.silent == 0 {
+		// results depending on a seed would change when the seed grows, they can't be cached.
+		// Neither can the results evaluated silently, a memo hit doesn't report the failures.
+		state.memo.put(key, result)
+	}
+	return result
+}
+
+// growRecord evaluates a left-recursive rule by growing a seed: the rule is evaluated again and
+// again at the same cursor, with its left-recursive evaluation at the cursor answered by the
+// result of the last round (a failure in the 1st round), until the result stops getting longer.
+// This way `expr = expr "+" term | term` matches "1+2+3" as ((1+2)+3).
+func (inst *Grammar) growRecord(key memoKey, charstream ICharstream) *EvalResult {
+	state := inst.state
+	record := key.record
+	start := key.cursor
+	entry := &seed{result: &EvalResult{Start: start, End: start, ErrIdx: start,
+		Error: fmt.Errorf("rule %s: left recursion", record.name)}}
+	state.seeds[key] = entry
+	var result *EvalResult
+	for {
+		charstream.Seek(start)
+		result = record.rule.Eval(inst, charstream, key.flag)
+		if result.Node == nil || (entry.result.Node != nil && result.End <= entry.result.End) {
+			break
+		}
+		entry.result = result
+	}
+	delete(state.seeds, key)
+	state.seedReads = state.seedReads - entry.reads // the result no longer depends on its own seed
+	if entry.result.Node != nil {
+		result = entry.result
+	}
+	charstream.Seek(result.End)
+	return result
+}
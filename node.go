@@ -32,6 +32,8 @@ type Node struct {
 	Virtual   bool
 	NonData   bool
 	Tokenized bool
+
+	parseErr *ParseError // the failure skipped by an error node, see EvalWithRecovery
 }
 
 func (inst *Node) CountNodes() int {
@@ -289,7 +291,7 @@ func (inst *Node) StringTree(config *NodeTreeConfig) string {
 	if len(inst.ChildNodes) > 0 {
 		// these are node types that have child nodes
 		switch inst.RuleType {
-		case TypeGroup, TypeOption, TypeBlock, TypeRepetition, TypeChoice, TypeConcatenate, TypeEmbed:
+		case TypeGroup, TypeOption, TypeBlock, TypeRepetition, TypeChoice, TypeConcatenate, TypeEmbed, TypeDifference:
 			size := len(inst.ChildNodes)
 			switch size {
 			case 0:
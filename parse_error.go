@@ -0,0 +1,175 @@
+package xbnf
+
+import (
+	"fmt"
+	"sort"
+	"strings"
+)
+
+// maxOffendingChars is the max # of chars of the offending text kept in a ParseError
+const maxOffendingChars = 32
+
+// ParseError reports why a charstream doesn't match a grammar. It's located at the furthest
+// cursor where a terminal or EOF was expected but not found, which is usually where the text
+// goes wrong.
+type ParseError struct {
+	Position  *Position // position of the failure
+	Cursor    int       // 0-based char index of the failure in the stream
+	Expected  []string  // terminals and rule names expected at the cursor, sorted
+	RuleStack []string  // names of rules being evaluated at the failure, the outermost first
+	Text      string    // the offending text starting at the cursor, up to the end of the line, or the line break at the end of a line
+	EOF       bool      // the failure is at the end of the stream
+	Source    string    // the source line of the failure, empty if it's not available
+}
+
+func (inst *ParseError) Error() string {
+	var buf strings.Builder
+	buf.WriteString(inst.Position.String())
+	if inst.EOF {
+		buf.WriteString(": unexpected EOF")
+	} else {
+		buf.WriteString(fmt.Sprintf(": unexpected `%s`", printable(inst.Text)))
+	}
+	if len(inst.Expected) > 0 {
+		buf.WriteString(", expecting ")
+		buf.WriteString(inst.expectedString())
+	}
+	if len(inst.RuleStack) > 0 {
+		buf.WriteString(fmt.Sprintf(" (in %s)", strings.Join(inst.RuleStack, " > ")))
+	}
+	return buf.String()
+}
+
+func (inst *ParseError) expectedString() string {
+	count := len(inst.Expected)
+	if count == 1 {
+		return inst.Expected[0]
+	}
+	return strings.Join(inst.Expected[:count-1], ", ") + " or " + inst.Expected[count-1]
+}
+
+// failure tracks the furthest failure during an evaluation
+type failure struct {
+	cursor    int // -1 means no failure yet
+	position  *Position
+	expected  []string // may have duplicates
+	ruleStack []string
+}
+
+// expect records that the rule, described by desc, is expected at the cursor but not found.
+// Only the failures at the furthest cursor are kept.
+func (inst *Grammar) expect(charstream ICharstream, cursor int, desc string) {
+	state := inst.state
+	if state == nil || state.silent > 0 || cursor < state.failure.cursor {
+		return
+	}
+	if cursor > state.failure.cursor {
+		state.failure.cursor = cursor
+		state.failure.position = positionAt(charstream, cursor)
+		state.failure.expected = state.failure.expected[:0]
+		state.failure.ruleStack = state.failure.ruleStack[:0]
+	}
+	state.failure.expected = append(state.failure.expected, desc)
+	if len(state.stack) > len(state.failure.ruleStack) {
+		// keep the deepest rule stack
+		state.failure.ruleStack = append(state.failure.ruleStack[:0], state.stack...)
+	}
+}
+
+// silence stops recording failures when on, until it's turned off. Used when rules are
+// evaluated just to probe the stream, such as the close rule of a block. Calls can be nested.
+func (inst *Grammar) silence(on bool) {
+	if inst.state == nil {
+		return
+	}
+	if on {
+		inst.state.silent++
+	} else {
+		inst.state.silent--
+	}
+}
+
+// parseError creates a ParseError of the furthest failure recorded, the cursor of the charstream
+// is kept. If no failure is recorded, the error is located at the cursor.
+func (inst *Grammar) parseError(charstream ICharstream) *ParseError {
+	cursor := charstream.Cursor()
+	parseErr := &ParseError{Cursor: cursor}
+	if inst.state != nil && inst.state.failure.cursor >= 0 {
+		failure := inst.state.failure
+		parseErr.Cursor = failure.cursor
+		parseErr.Position = failure.position
+		seen := make(map[string]bool)
+		for _, expected := range failure.expected {
+			if !seen[expected] {
+				seen[expected] = true
+				parseErr.Expected = append(parseErr.Expected, expected)
+			}
+		}
+		sort.Strings(parseErr.Expected)
+		parseErr.RuleStack = append([]string(nil), failure.ruleStack...)
+	} else {
+		parseErr.Position = positionAt(charstream, cursor)
+	}
+	charstream.Seek(parseErr.Cursor)
+	var text []rune
+	for len(text) < maxOffendingChars {
+		char := charstream.Next()
+		if char == EOFChar || char == '\n' {
+			break
+		}
+		text = append(text, char)
+	}
+	parseErr.Text = strings.TrimRight(string(text), "\r")
+	charstream.Seek(parseErr.Cursor)
+	parseErr.EOF = charstream.Peek() == EOFChar
+	if parseErr.Text == "" && !parseErr.EOF {
+		// the failure is at the end of a line
+		parseErr.Text = "\n"
+		if charstream.Peek() == '\r' {
+			parseErr.Text = "\r\n"
+		}
+	}
+	if parseErr.Position != nil {
+		lineStart := parseErr.Cursor - parseErr.Position.Col + 1
+		// the beginning of the line may be released by the charstream
+		if lineStart == 0 || (lineStart > 0 && charstream.PositionLookup(lineStart) != nil) {
+			charstream.Seek(lineStart)
+			var line []rune
+			for {
+				char := charstream.Next()
+				if char == EOFChar || char == '\n' {
+					break
+				}
+				line = append(line, char)
+			}
+			parseErr.Source = strings.TrimRight(string(line), "\r")
+		}
+	}
+	charstream.Seek(cursor)
+	return parseErr
+}
+
+// positionAt returns the position of the char at the cursor. If the cursor is at EOF, it's the
+// position right after the last char.
+func positionAt(charstream ICharstream, cursor int) *Position {
+	saved := charstream.Cursor()
+	defer charstream.Seek(saved)
+
+	charstream.Seek(cursor)
+	if position := charstream.Position(); position != nil || cursor == 0 {
+		if position == nil {
+			position = &Position{Line: 1, Col: 1}
+		}
+		return position
+	}
+	// EOF, locate the last char
+	charstream.Seek(cursor - 1)
+	last := charstream.Position()
+	if last == nil {
+		return nil
+	}
+	if charstream.Next() == '\n' {
+		return &Position{Line: last.Line + 1, Col: 1}
+	}
+	return &Position{Line: last.Line, Col: last.Col + 1}
+}
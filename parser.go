@@ -0,0 +1,196 @@
+package xbnf
+
+import (
+	"context"
+	"sync"
+)
+
+// Parser is a compiled grammar, see Grammar.Compile. It never changes, so texts can be evaluated
+// by one parser from many goroutines at the same time.
+type Parser struct {
+	grammar *Grammar // the frozen grammar, only its copies are evaluated
+
+	lock      sync.Mutex
+	memoStats MemoStats // memo statistics of all evaluations
+}
+
+// Compile validates the grammar and freezes a copy of it into a Parser. The rules are copied with
+// their references resolved, and the analysis is done up front, so nothing is looked up or
+// computed lazily during the evaluations. The grammar itself is not changed, and its changes
+// afterwards don't affect the parser. Compile must not be called while the grammar is evaluating
+// a text.
+func (inst *Grammar) Compile() (*Parser, error) {
+	if err := inst.Validate(); err != nil {
+		return nil, err
+	}
+	frozen := *inst
+	copies := make(map[*RuleRecord]*RuleRecord)
+	frozen.ruleRecords = copyRecords(inst.ruleRecords, copies)
+	frozen.terminals = copyRecords(inst.terminals, copies)
+	frozen.rootRules = copyRecords(inst.rootRules, copies)
+	frozen.nonRoots = make(map[string][]string)
+	for name, users := range inst.nonRoots {
+		frozen.nonRoots[name] = append([]string(nil), users...)
+	}
+	frozen.syncRules = append([]string(nil), inst.syncRules...)
+	frozen.imported = nil
+	frozen.loading = nil
+	frozen.state = nil
+	frozen.memoStats = MemoStats{}
+	frozen.lr = frozen.analyzeLeftRecursion()
+	frozen.analysis = frozen.analyze()
+	for _, record := range frozen.ruleRecords {
+		walkRule(record.rule, func(rule IRule) {
+			if ref, ok := rule.(*ReferenceRule); ok {
+				ref.record = frozen.ruleRecords[ref.refName]
+			}
+		})
+	}
+	return &Parser{grammar: &frozen}, nil
+}
+
+// copyRecords copies the records and their rules, the copies made so far are reused, so a record
+// in many maps is copied once.
+func copyRecords(records map[string]*RuleRecord, copies map[*RuleRecord]*RuleRecord) map[string]*RuleRecord {
+	result := make(map[string]*RuleRecord, len(records))
+	for name, record := range records {
+		copied := copies[record]
+		if copied == nil {
+			copied = &RuleRecord{}
+			*copied = *record
+			copied.rule = cloneRule(record.rule)
+			copies[record] = copied
+		}
+		result[name] = copied
+	}
+	return result
+}
+
+// cloneRule copies a rule and its sub rules down to the references, so the references of the copy
+// can be resolved without changing the rule. The terminals never change, they are shared.
+func cloneRule(rule IRule) IRule {
+	switch r := rule.(type) {
+	case *ReferenceRule:
+		clone := *r
+		return &clone
+	case *GroupRule:
+		clone := *r
+		clone.rule = cloneRule(r.rule)
+		return &clone
+	case *OptionRule:
+		clone := *r
+		clone.rule = cloneRule(r.rule)
+		return &clone
+	case *PredicateRule:
+		clone := *r
+		clone.rule = cloneRule(r.rule)
+		return &clone
+	case *RepetitionRule:
+		clone := *r
+		clone.rule = cloneRule(r.rule)
+		return &clone
+	case *DifferenceRule:
+		clone := *r
+		clone.rule = cloneRule(r.rule)
+		clone.excluded = cloneRule(r.excluded)
+		return &clone
+	case *ConcatenateRule:
+		clone := *r
+		clone.rules = cloneRules(r.rules)
+		return &clone
+	case *ChoiceRule:
+		clone := *r
+		clone.groups = make([][]IRule, len(r.groups))
+		for i, group := range r.groups {
+			clone.groups[i] = cloneRules(group)
+		}
+		return &clone
+	case *BlockRule:
+		clone := *r
+		clone.open = cloneRule(r.open)
+		clone.close = cloneRule(r.close)
+		clone.escape = cloneRule(r.escape)
+		clone.excludes = cloneRules(r.excludes)
+		return &clone
+	}
+	return rule
+}
+
+func cloneRules(rules []IRule) []IRule {
+	clones := make([]IRule, len(rules))
+	for i, rule := range rules {
+		clones[i] = cloneRule(rule)
+	}
+	return clones
+}
+
+// evaluator returns a grammar to evaluate a text with, it shares all rules and analysis with
+// the frozen grammar, but has its own evaluation states.
+func (inst *Parser) evaluator() *Grammar {
+	grammar := *inst.grammar
+	return &grammar
+}
+
+// collect adds the memo statistics of an evaluator to the ones of the parser
+func (inst *Parser) collect(evaluator *Grammar) {
+	inst.lock.Lock()
+	defer inst.lock.Unlock()
+	stats := evaluator.memoStats
+	inst.memoStats.Hits = inst.memoStats.Hits + stats.Hits
+	inst.memoStats.Misses = inst.memoStats.Misses + stats.Misses
+	inst.memoStats.Evictions = inst.memoStats.Evictions + stats.Evictions
+}
+
+// MemoStats returns the memo statistics of all evaluations of the parser, see Grammar.EnableMemo
+func (inst *Parser) MemoStats() MemoStats {
+	inst.lock.Lock()
+	defer inst.lock.Unlock()
+	return inst.memoStats
+}
+
+// Eval is the same as Grammar.Eval
+func (inst *Parser) Eval(charstream ICharstream, simplifyLevel int) (*AST, error) {
+	evaluator := inst.evaluator()
+	defer inst.collect(evaluator)
+	return evaluator.Eval(charstream, simplifyLevel)
+}
+
+// EvalFrom is the same as Grammar.EvalFrom
+func (inst *Parser) EvalFrom(ruleName string, charstream ICharstream, simplifyLevel int) (*AST, error) {
+	evaluator := inst.evaluator()
+	defer inst.collect(evaluator)
+	return evaluator.EvalFrom(ruleName, charstream, simplifyLevel)
+}
+
+// EvalWithRecovery is the same as Grammar.EvalWithRecovery
+func (inst *Parser) EvalWithRecovery(charstream ICharstream, simplifyLevel int) (*AST, []*ParseError, error) {
+	evaluator := inst.evaluator()
+	defer inst.collect(evaluator)
+	return evaluator.EvalWithRecovery(charstream, simplifyLevel)
+}
+
+// EvalContext is the same as Grammar.EvalContext
+func (inst *Parser) EvalContext(ctx context.Context, charstream ICharstream, simplifyLevel int) (*AST, error) {
+	evaluator := inst.evaluator()
+	defer inst.collect(evaluator)
+	return evaluator.EvalContext(ctx, charstream, simplifyLevel)
+}
+
+// EvalFromContext is the same as Grammar.EvalFromContext
+func (inst *Parser) EvalFromContext(ctx context.Context, ruleName string, charstream ICharstream, simplifyLevel int) (*AST, error) {
+	evaluator := inst.evaluator()
+	defer inst.collect(evaluator)
+	return evaluator.EvalFromContext(ctx, ruleName, charstream, simplifyLevel)
+}
+
+// EvalWithRecoveryContext is the same as Grammar.EvalWithRecoveryContext
+func (inst *Parser) EvalWithRecoveryContext(ctx context.Context, charstream ICharstream, simplifyLevel int) (*AST, []*ParseError, error) {
+	evaluator := inst.evaluator()
+	defer inst.collect(evaluator)
+	return evaluator.EvalWithRecoveryContext(ctx, charstream, simplifyLevel)
+}
+
+// Analysis returns the analysis of the rules done by Compile
+func (inst *Parser) Analysis() *Analysis {
+	return inst.grammar.analysis
+}
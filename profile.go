@@ -0,0 +1,143 @@
+package xbnf
+
+import (
+	"fmt"
+	"io"
+	"sort"
+	"sync"
+	"text/tabwriter"
+	"time"
+)
+
+// RuleProfile is how a named rule is evaluated, see Profiler
+type RuleProfile struct {
+	Rule        string
+	Evaluations int           // # of evaluations, memo hits included
+	Matches     int           // # of evaluations that matched
+	Failures    int           // # of evaluations that failed
+	Backtracked int           // # of chars the failed evaluations went through before failing
+	Time        time.Duration // cumulative time of the evaluations, the rules evaluated by them included
+}
+
+// Profiler collects the RuleProfile of each named rule over the evaluations of a grammar, see
+// SetProfiler. It's safe for concurrent use.
+type Profiler struct {
+	lock  sync.Mutex
+	rules map[string]*RuleProfile
+}
+
+// ruleProfiling is the profile of a rule in one evaluation of a charstream
+type ruleProfiling struct {
+	RuleProfile
+	active int       // # of evaluations of the rule in progress, ie. recursion
+	start  time.Time // when the outermost evaluation in progress started
+}
+
+// NewProfiler creates a profiler with no profile
+func NewProfiler() *Profiler {
+	return &Profiler{rules: make(map[string]*RuleProfile)}
+}
+
+// SetProfiler sets the profiler of the evaluations of texts, nil turns profiling off. The
+// profiler of a Parser is the one of the grammar when it's compiled, it may be shared by many
+// grammars and parsers.
+func (inst *Grammar) SetProfiler(profiler *Profiler) {
+	inst.profiler = profiler
+}
+
+// Profiles returns the profiles of the rules evaluated so far, the slowest first.
+func (inst *Profiler) Profiles() []*RuleProfile {
+	inst.lock.Lock()
+	profiles := make([]*RuleProfile, 0, len(inst.rules))
+	for _, profile := range inst.rules {
+		copied := *profile
+		profiles = append(profiles, &copied)
+	}
+	inst.lock.Unlock()
+	sort.Slice(profiles, func(i, j int) bool {
+		if profiles[i].Time != profiles[j].Time {
+			return profiles[i].Time > profiles[j].Time
+		}
+		if profiles[i].Evaluations != profiles[j].Evaluations {
+			return profiles[i].Evaluations > profiles[j].Evaluations
+		}
+		return profiles[i].Rule < profiles[j].Rule
+	})
+	return profiles
+}
+
+// Reset drops the profiles collected so far
+func (inst *Profiler) Reset() {
+	inst.lock.Lock()
+	defer inst.lock.Unlock()
+	inst.rules = make(map[string]*RuleProfile)
+}
+
+// WriteTable writes the profiles as a table, the slowest rule first. The top limits the # of
+// rules written, 0 means all.
+func (inst *Profiler) WriteTable(writer io.Writer, top int) error {
+	profiles := inst.Profiles()
+	if top > 0 && len(profiles) > top {
+		profiles = profiles[:top]
+	}
+	table := tabwriter.NewWriter(writer, 0, 0, 2, ' ', 0)
+	fmt.Fprintf(table, "rule\tevaluations\tmatches\tfailures\tbacktracked\ttime\n")
+	for _, profile := range profiles {
+		fmt.Fprintf(table, "%s\t%d\t%d\t%d\t%d\t%s\n", profile.Rule, profile.Evaluations,
+			profile.Matches, profile.Failures, profile.Backtracked, profile.Time)
+	}
+	return table.Flush()
+}
+
+// merge adds the profiles of an evaluation of a charstream
+func (inst *Profiler) merge(profiles map[string]*ruleProfiling) {
+	inst.lock.Lock()
+	defer inst.lock.Unlock()
+	for name, profiling := range profiles {
+		profile := inst.rules[name]
+		if profile == nil {
+			profile = &RuleProfile{Rule: name}
+			inst.rules[name] = profile
+		}
+		profile.Evaluations = profile.Evaluations + profiling.Evaluations
+		profile.Matches = profile.Matches + profiling.Matches
+		profile.Failures = profile.Failures + profiling.Failures
+		profile.Backtracked = profile.Backtracked + profiling.Backtracked
+		profile.Time = profile.Time + profiling.Time
+	}
+}
+
+// profileRecord evaluates a named rule and counts the evaluation in the profile of the rule.
+// The time of a recursive rule is counted by its outermost evaluation only.
+func (inst *Grammar) profileRecord(state *evalState, record *RuleRecord, charstream ICharstream, flagLeadingSpaces int) *EvalResult {
+	profiling := state.profiles[record.name]
+	if profiling == nil {
+		profiling = &ruleProfiling{RuleProfile: RuleProfile{Rule: record.name}}
+		state.profiles[record.name] = profiling
+	}
+	if profiling.active == 0 {
+		profiling.start = time.Now()
+	}
+	profiling.active++
+	cursor := charstream.Cursor()
+	var result *EvalResult
+	if inst.tracer != nil {
+		result = inst.traceRecord(state, record, charstream, flagLeadingSpaces)
+	} else {
+		result = inst.evalStacked(state, record, charstream, flagLeadingSpaces)
+	}
+	profiling.active--
+	if profiling.active == 0 {
+		profiling.Time = profiling.Time + time.Since(profiling.start)
+	}
+	profiling.Evaluations++
+	if result.Node != nil {
+		profiling.Matches++
+	} else {
+		profiling.Failures++
+		if result.ErrIdx > cursor {
+			profiling.Backtracked = profiling.Backtracked + result.ErrIdx - cursor
+		}
+	}
+	return result
+}
@@ -0,0 +1,97 @@
+package xbnf
+
+// SetSyncRules sets the rules where EvalWithRecovery resumes the evaluation after a failure,
+// such as a statement terminator. It's the same as the `@sync` directive in a grammar file.
+func (inst *Grammar) SetSyncRules(names ...string) {
+	inst.syncRules = append([]string(nil), names...)
+}
+
+// skipToSync skips the chars from the start cursor to the end of the first sync rule match
+// found at or after the from cursor, or to EOF if there is no match and toEOF is true. The
+// skipped chars, without the leading insignificant chars, are returned as an error node of the
+// failure, and the charstream is left after them. Nil is returned if no char is skipped, the
+// charstream is left at the start cursor then.
+func (inst *Grammar) skipToSync(cs ICharstream, start int, from int, parseErr *ParseError, toEOF bool) *Node {
+	cs.Seek(start)
+	inst.skip(cs)
+	skipped := cs.Cursor()
+	if from < skipped {
+		from = skipped
+	}
+	var records []*RuleRecord
+	for _, name := range inst.syncRules {
+		if record := inst.GetRecord(name); record != nil {
+			records = append(records, record)
+		}
+	}
+
+	end := -1
+	cs.Seek(from)
+	inst.silence(true)
+	for end < 0 && cs.Peek() != EOFChar {
+		cursor := cs.Cursor()
+		for _, record := range records {
+			cs.Seek(cursor)
+			result := inst.evalRecord(record, cs, NOT_SKIP)
+			if result.Node != nil && result.End > cursor {
+				end = result.End
+				break
+			}
+		}
+		if end < 0 {
+			cs.Seek(cursor + 1)
+		}
+	}
+	inst.silence(false)
+	if end < 0 && toEOF {
+		end = cs.Cursor() // EOF
+	}
+	if end <= skipped {
+		// no sync rule match, or nothing but insignificant chars to skip
+		cs.Seek(start)
+		return nil
+	}
+
+	node := &Node{RuleType: TypeError, RuleName: "_", Position: positionAt(cs, skipped), parseErr: parseErr}
+	node.Chars = readChars(cs, skipped, end)
+	cs.Seek(end)
+	// the next failure is reported on its own
+	if inst.state != nil {
+		inst.state.failure.cursor = -1
+	}
+	return node
+}
+
+// recoverElement skips a failed element of a repetition, evaluated at the cursor, to the end of
+// the next sync rule match. It's done only by EvalWithRecovery, and only if the element failed
+// after a significant char, otherwise the failure is just the end of the repetition. Nil is
+// returned if the failure is not recovered.
+func (inst *Grammar) recoverElement(cs ICharstream, cursor int, flagLeadingSpaces int) *Node {
+	state := inst.state
+	if state == nil || !state.recovery || state.silent > 0 || state.failure.cursor < 0 {
+		return nil
+	}
+	cs.Seek(cursor)
+	if flagLeadingSpaces != NOT_SKIP {
+		inst.skip(cs)
+	}
+	if state.failure.cursor <= cs.Cursor() {
+		return nil
+	}
+	parseErr := inst.parseError(cs)
+	return inst.skipToSync(cs, cursor, parseErr.Cursor, parseErr, false)
+}
+
+// collectDiagnostics appends the failures of the error nodes in the tree of the node
+func collectDiagnostics(node *Node, diagnostics []*ParseError) []*ParseError {
+	if node == nil {
+		return diagnostics
+	}
+	if node.parseErr != nil {
+		diagnostics = append(diagnostics, node.parseErr)
+	}
+	for _, child := range node.ChildNodes {
+		diagnostics = collectDiagnostics(child, diagnostics)
+	}
+	return diagnostics
+}
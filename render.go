@@ -0,0 +1,120 @@
+package xbnf
+
+import (
+	"errors"
+	"fmt"
+	"strings"
+	"unicode"
+)
+
+// maxRenderedExpected is the max # of expected terminals listed by Render
+const maxRenderedExpected = 8
+
+// ANSI escape codes used to colour the rendered errors
+const (
+	ansiReset = "\033[0m"
+	ansiBold  = "\033[1m"
+	ansiRed   = "\033[1;31m"
+	ansiGreen = "\033[1;32m"
+	ansiBlue  = "\033[1;34m"
+)
+
+// Render formats the error the way compilers do, for example:
+//
+//	sample.json:2:7: error: unexpected `nul }`
+//	  2 |  "b": nul }
+//	    |       ^
+//	expected "[", "false", "null", "true", "{", '"', '-', '0' or 9 more
+//
+// The filename may be empty. If color is true, the output is coloured by ANSI escape codes.
+func (inst *ParseError) Render(filename string, color bool) string {
+	paint := func(code string, text string) string {
+		if !color {
+			return text
+		}
+		return code + text + ansiReset
+	}
+	var buf strings.Builder
+	location := "?"
+	if inst.Position != nil {
+		location = fmt.Sprintf("%d:%d", inst.Position.Line, inst.Position.Col)
+	}
+	if filename != "" {
+		location = filename + ":" + location
+	}
+	message := fmt.Sprintf("unexpected `%s`", printable(inst.Text))
+	if inst.EOF {
+		message = "unexpected EOF"
+	}
+	buf.WriteString(fmt.Sprintf("%s: %s %s\n", paint(ansiBold, location), paint(ansiRed, "error:"), paint(ansiBold, message)))
+
+	if inst.Position != nil && (inst.Source != "" || inst.Position.Col == 1) {
+		lineNo := fmt.Sprintf("%d", inst.Position.Line)
+		gutter := strings.Repeat(" ", len(lineNo))
+		buf.WriteString(fmt.Sprintf("%s %s %s\n", paint(ansiBlue, lineNo), paint(ansiBlue, "|"), inst.Source))
+		// keep the tabs before the column, so the caret is aligned with the failing char
+		var marker strings.Builder
+		source := []rune(inst.Source)
+		for i := 0; i < inst.Position.Col-1; i++ {
+			if i < len(source) && source[i] == '\t' {
+				marker.WriteRune('\t')
+			} else {
+				marker.WriteRune(' ')
+			}
+		}
+		buf.WriteString(fmt.Sprintf("%s %s %s%s\n", gutter, paint(ansiBlue, "|"), marker.String(), paint(ansiGreen, "^")))
+	}
+
+	count := len(inst.Expected)
+	if count > 0 {
+		buf.WriteString("expected ")
+		if count > maxRenderedExpected {
+			buf.WriteString(strings.Join(inst.Expected[:maxRenderedExpected], ", "))
+			buf.WriteString(fmt.Sprintf(" or %d more", count-maxRenderedExpected))
+		} else {
+			buf.WriteString(inst.expectedString())
+		}
+		buf.WriteRune('\n')
+	}
+	return buf.String()
+}
+
+// RenderError formats an error returned by the grammar. A ParseError is rendered with the
+// source snippet, other errors are rendered in the same format without the snippet.
+func RenderError(err error, filename string, color bool) string {
+	var parseErr *ParseError
+	if errors.As(err, &parseErr) {
+		return parseErr.Render(filename, color)
+	}
+	label := "error:"
+	if color {
+		label = ansiRed + label + ansiReset
+	}
+	if filename == "" {
+		return fmt.Sprintf("%s %s\n", label, err)
+	}
+	if color {
+		filename = ansiBold + filename + ansiReset
+	}
+	return fmt.Sprintf("%s: %s %s\n", filename, label, err)
+}
+
+// printable escapes the control chars of a text, such as tabs, so they are visible in a message
+func printable(text string) string {
+	var buf strings.Builder
+	for _, char := range text {
+		switch {
+		case char == '\t':
+			buf.WriteString(`\t`)
+		case char == '\r':
+			buf.WriteString(`\r`)
+		case char == '\n':
+			buf.WriteString(`\n`)
+		case unicode.IsControl(char):
+			buf.WriteString(fmt.Sprintf(`\u%04X`, char))
+		default:
+			buf.WriteRune(char)
+		}
+	}
+	return buf.String()
+}
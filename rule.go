@@ -21,6 +21,9 @@ const (
 	TypeEOF         = Type("EOF") // Predefined rule type
 	TypeChar        = Type("char")
 	TypeRange       = Type("range")
+	TypeClass       = Type("class")
+	TypeSet         = Type("set")
+	TypeAny         = Type("any")
 	TypeChars       = Type("chars")
 	TypeString      = Type("string")
 	TypeGroup       = Type("group")
@@ -30,9 +33,12 @@ const (
 	TypeRepetition  = Type("repetition")
 	TypeChoice      = Type("choice")
 	TypeConcatenate = Type("concatenate")
+	TypePredicate   = Type("predicate")
+	TypeDifference  = Type("difference")
 
 	TypeEmbed = Type("embed") // just for node parsed using EvalEmbed
 	TypeText  = Type("text")  // just for free text node parsed using EvalEmbed
+	TypeError = Type("error") // just for node of skipped text parsed using EvalWithRecovery
 )
 
 // leading spaces handling flag
@@ -50,13 +56,14 @@ type EvalResult struct {
 	Error  error
 	ErrIdx int // the index where the error occurs
 
-	// total chars read from the Charstream, including those CharsUnused, if there
-	// is any, at the end
-	CharsRead []rune
+	// the cursor of the Charstream where the evaluation starts
+	Start int
 
-	// In order to evaluate against the rule, the chars read from Charstream but not used by
-	// the Node. This is for continuous rule evaluations on a Charstream
-	CharsUnused []rune
+	// the cursor of the Charstream right after the last char used by the Node. If the rule is
+	// not matched, End is equal to Start. After an evaluation, the Charstream is always left at
+	// End, so chars read beyond End in order to evaluate the rule are available to the next
+	// rule, and continuous rule evaluations on a Charstream need no more bookkeeping.
+	End int
 
 	// during parsing, whether space(s) are allowed between the node of this result and its
 	// right neighber rule
@@ -71,18 +78,14 @@ func (inst *EvalResult) MergeStickyNodes() {
 }
 
 func (inst *EvalResult) countCharsUsed() int {
-	return len(inst.CharsRead) - len(inst.CharsUnused)
-}
-
-func (inst *EvalResult) charsUsed() []rune {
-	return inst.CharsRead[:len(inst.CharsRead)-len(inst.CharsUnused)]
+	return inst.End - inst.Start
 }
 
 func (inst *EvalResult) StringTree(config *NodeTreeConfig) string {
 	var buf strings.Builder
 	buf.WriteString("EvalResult")
-	buf.WriteString(fmt.Sprintf("\n├───CharsRead[%d]  :%s*", len(inst.CharsRead), string(inst.CharsRead)))
-	buf.WriteString(fmt.Sprintf("\n├───CharsUnused[%d]:%s*", len(inst.CharsUnused), string(inst.CharsUnused)))
+	buf.WriteString(fmt.Sprintf("\n├───Start:%d", inst.Start))
+	buf.WriteString(fmt.Sprintf("\n├───End  :%d", inst.End))
 	if inst.Node == nil {
 		buf.WriteString("\n└───Node: nil")
 		if inst.Error != nil {
@@ -270,18 +273,15 @@ func validateRuleName(ruleName string) (validRuleName string, err error) {
 }
 
 // Given a list of rules, find the most greedy match. If no rule matches, return a evalResult with
-// nil node.
+// nil node. All rules are evaluated from the same cursor, the charstream is left at the end of
+// the match found, or at the start if no match.
 func mostGreedy(grammar *Grammar, charStream ICharstream, flagLeadingSpaces int, rules []IRule) *EvalResult {
-	evalResult := &EvalResult{}
+	start := charStream.Cursor()
+	evalResult := &EvalResult{Start: start, End: start}
 	var resultsMatched []*EvalResult
-	var maxCharsRead []rune // the max chars read to evaluate all rules
-	cs := charStream
 	for _, rule := range rules {
-		cs := newCharstreamPrepend(cs, maxCharsRead)
-		result := rule.Eval(grammar, cs, flagLeadingSpaces)
-		if len(maxCharsRead) < len(result.CharsRead) {
-			maxCharsRead = result.CharsRead
-		}
+		charStream.Seek(start)
+		result := rule.Eval(grammar, charStream, flagLeadingSpaces)
 		if result.Node != nil {
 			resultsMatched = append(resultsMatched, result)
 		}
@@ -289,9 +289,7 @@ func mostGreedy(grammar *Grammar, charStream ICharstream, flagLeadingSpaces int,
 	matches := len(resultsMatched)
 	var resultFound *EvalResult
 	if matches == 0 {
-		// no match, all CharsRead are unused
-		evalResult.CharsRead = maxCharsRead
-		evalResult.CharsUnused = evalResult.CharsRead
+		charStream.Seek(start)
 		return evalResult
 	} else if matches == 1 {
 		resultFound = resultsMatched[0]
@@ -310,6 +308,7 @@ func mostGreedy(grammar *Grammar, charStream ICharstream, flagLeadingSpaces int,
 				buf.WriteString(fmt.Sprintf("\t\n%s", string(maxResult.Node.Text())))
 				buf.WriteString(fmt.Sprintf("\t\n%s", string(result.Node.Text())))
 				evalResult.Error = errors.New(buf.String())
+				charStream.Seek(start)
 				return evalResult
 			}
 			maxUsed = countCharsUsed
@@ -317,9 +316,9 @@ func mostGreedy(grammar *Grammar, charStream ICharstream, flagLeadingSpaces int,
 		}
 		resultFound = maxResult
 	}
-	evalResult.CharsRead = maxCharsRead
+	charStream.Seek(resultFound.End)
+	evalResult.End = resultFound.End
 	evalResult.Node = resultFound.Node
 	evalResult.Sticky = resultFound.Sticky
-	evalResult.CharsUnused = evalResult.CharsRead[resultFound.countCharsUsed():]
 	return evalResult
 }
@@ -58,7 +58,10 @@ func (inst *BlockRule) StringWithIndent(indent string) string {
 // the open and close quote. Return error if there is no quote text, and the
 // chars read so far in order to find the quote.
 func (inst *BlockRule) Eval(grammar *Grammar, charstream ICharstream, flagLeadingSpaces int) *EvalResult {
+	start := charstream.Cursor()
 	evalResult := &EvalResult{
+		Start:  start,
+		End:    start,
 		Sticky: false,
 	}
 	node := &Node{
@@ -70,22 +73,14 @@ func (inst *BlockRule) Eval(grammar *Grammar, charstream ICharstream, flagLeadin
 		Sticky:    false, // block of text is always non-sticky,
 	}
 
-	cs := charstream
-	var charsUsed []rune
-	var charsUnused []rune
-
 	// check the open chars of the block text
-	result := inst.open.Eval(grammar, cs, flagLeadingSpaces)
+	result := inst.open.Eval(grammar, charstream, flagLeadingSpaces)
 	if result.Node != nil {
 		node.ChildNodes = append(node.ChildNodes, result.Node) // the 1st child of block node is always open node
-		charsUsed = append(charsUsed, result.CharsRead[:result.countCharsUsed()]...)
-		charsUnused = result.CharsUnused
 		node.Position = result.Node.Position
 	} else {
 		evalResult.Error = result.Error
-		evalResult.CharsRead = result.CharsRead
-		evalResult.CharsUnused = result.CharsUnused
-		evalResult.ErrIdx = charstream.Cursor()
+		evalResult.ErrIdx = result.ErrIdx
 		return evalResult
 	}
 
@@ -95,111 +90,97 @@ func (inst *BlockRule) Eval(grammar *Grammar, charstream ICharstream, flagLeadin
 		Sticky:   true,
 	}
 	node.ChildNodes = append(node.ChildNodes, content)
-	cs = newCharstreamPrepend(cs, charsUnused)
-	content.Position = cs.Position()
-	var closeResult *EvalResult
+	content.Position = charstream.Position()
 	var escapeChars []rune
 	for {
+		if err := grammar.checkLimits(charstream, nil); err != nil {
+			evalResult.Error = err
+			evalResult.ErrIdx = charstream.Cursor()
+			charstream.Seek(start)
+			return evalResult
+		}
 		// check if we have an escape as next match
 		escaped := false
 		escapeChars = nil
 		if inst.escape != nil { // evaluation escape
-			result = inst.escape.Eval(grammar, cs, NOT_SKIP) // do not skip space chars
+			// probing the escape, excludes and close at every char is not a failure
+			grammar.silence(true)
+			result = inst.escape.Eval(grammar, charstream, NOT_SKIP) // do not skip space chars
+			grammar.silence(false)
 			if result.Node != nil {
-				charsUsed = append(charsUsed, result.CharsRead[:result.countCharsUsed()]...)
-				charsUnused = result.CharsUnused
 				escaped = true
-				escapeChars = result.charsUsed() // save the escapeChars so we can decide later whether to include them in the result content
-				// content.Chars = append(content.Chars, result.charsUsed()...) // the escape char should NOT be preserved
-				// check if there is an escape token after escape token
-				/**
-				cs = newCharstreamPrepend(cs, charsUnused)
-				result = inst.escape.Eval(grammar, cs, NOT_SKIP) // do not skip space chars
-				if result.Node != nil {
-					// see an escape token after an escape token
-					charsUsed = append(charsUsed, result.CharsRead[:result.countCharsUsed()]...)
-					charsUnused = result.CharsUnused
-					content.Chars = append(content.Chars, result.charsUsed()...)
-					continue
-				} else {
-					escaped = true
-					charsUnused = result.CharsRead
-				}
-				*/
-			} else {
-				charsUnused = result.CharsRead
+				// save the escapeChars so we can decide later whether to include them in the result
+				// content, the escape char should NOT be preserved if it escapes an exclude or close
+				escapeChars = readChars(charstream, result.Start, result.End)
 			}
 		}
 
 		// find exclude match(es)
-		cs = newCharstreamPrepend(cs, charsUnused)
 		if len(inst.excludes) > 0 {
-			resultExclude := mostGreedy(grammar, cs, NOT_SKIP, inst.excludes)
+			grammar.silence(true)
+			resultExclude := mostGreedy(grammar, charstream, NOT_SKIP, inst.excludes)
+			grammar.silence(false)
 			if resultExclude.Node != nil { // found one
+				excludeChars := readChars(charstream, resultExclude.Start, resultExclude.End)
 				if escaped {
-					charsUsed = append(charsUsed, resultExclude.charsUsed()...)
-					charsUnused = resultExclude.CharsUnused
-					content.Chars = append(content.Chars, resultExclude.charsUsed()...)
+					content.Chars = append(content.Chars, excludeChars...)
 					continue
 				}
-				evalResult.Error = fmt.Errorf("text `%s` is not allowed in text block", string(resultExclude.charsUsed()))
-				evalResult.ErrIdx = charstream.Cursor()
-				evalResult.CharsRead = append(charsUsed, content.Chars...)
-				evalResult.CharsRead = append(evalResult.CharsRead, resultExclude.CharsRead...)
-				evalResult.CharsUnused = evalResult.CharsRead
+				evalResult.Error = fmt.Errorf("text `%s` is not allowed in text block", string(excludeChars))
+				evalResult.ErrIdx = resultExclude.Start
+				grammar.expect(charstream, evalResult.ErrIdx, inst.close.desc()) // the block should be closed before it
+				charstream.Seek(start)
 				return evalResult
 			}
-			charsUnused = resultExclude.CharsRead
 		}
 
 		// check close rule
-		cs = newCharstreamPrepend(cs, charsUnused)
-		result := inst.close.Eval(grammar, cs, NOT_SKIP) // do not skip space
-		charsUnused = result.CharsUnused
+		grammar.silence(true)
+		result := inst.close.Eval(grammar, charstream, NOT_SKIP) // do not skip space
+		grammar.silence(false)
 		if result.Node != nil {
 			if escaped {
-				charsUsed = append(charsUsed, result.charsUsed()...)
-				content.Chars = append(content.Chars, result.charsUsed()...)
+				content.Chars = append(content.Chars, readChars(charstream, result.Start, result.End)...)
 				continue
 			}
-			closeResult = result
-			if !inst.virtualClose {
+			if inst.virtualClose {
+				// the chars used by the close rule are left to the next rule
+				charstream.Seek(result.Start)
+			} else {
 				node.ChildNodes = append(node.ChildNodes, result.Node) // the 3rd child of block node is always close node
 			}
-			charsUsed = append(charsUsed, content.Chars...)
-			charsUsed = append(charsUsed, result.CharsRead[:result.countCharsUsed()]...)
 			break
 		} else {
 			content.Chars = append(content.Chars, escapeChars...)
 		}
-		cs = newCharstreamPrepend(cs, charsUnused)
-		char := cs.Peek()
+		char := charstream.Peek()
 		if char == EOFChar {
-			charsUsed = append(charsUsed, content.Chars...)
 			evalResult.Error = fmt.Errorf("missing %s at EOF", inst.close.desc())
 			evalResult.ErrIdx = charstream.Cursor()
-			break
+			grammar.expect(charstream, evalResult.ErrIdx, inst.close.desc())
+			charstream.Seek(start)
+			return evalResult
 		}
-		char = cs.Next()
+		char = charstream.Next()
 		content.Chars = append(content.Chars, escapeChars...)
 		content.Chars = append(content.Chars, char)
-		charsUnused = nil
 	}
-	evalResult.CharsRead = append(charsUsed, charsUnused...)
-	if evalResult.Error != nil {
-		evalResult.CharsUnused = evalResult.CharsRead
-	} else {
-		if inst.virtualClose {
-			evalResult.CharsUnused = closeResult.CharsRead
-		} else {
-			evalResult.CharsUnused = charsUnused
-		}
-		evalResult.Node = node
-	}
-
+	evalResult.End = charstream.Cursor()
+	evalResult.Node = node
 	return evalResult
 }
 
+// readChars returns the chars between the from and to cursors of the charstream, the
+// charstream is left at the to cursor.
+func readChars(charstream ICharstream, from, to int) []rune {
+	charstream.Seek(from)
+	chars := make([]rune, 0, to-from)
+	for charstream.Cursor() < to {
+		chars = append(chars, charstream.Next())
+	}
+	return chars
+}
+
 // This function expects '<' as the 1st char in the input charstream.
 func inBlock(grammar *Grammar, name string, charstream ICharstream) (*BlockRule, error) {
 	block := &BlockRule{}
@@ -210,7 +191,10 @@ func inBlock(grammar *Grammar, name string, charstream ICharstream) (*BlockRule,
 	}
 
 	// get the first open rule
-	openRule, err := grammar.parse(name, cs, []rune{' ', blockCloseSymbol, blockVirtualClose}) // inside block rule, the rules are separated by a space(s)
+	if err := checkNotPredicate(cs); err != nil {
+		return nil, err
+	}
+	openRule, err := grammar.parse(name, cs, []rune{' ', '\n', blockCloseSymbol, blockVirtualClose}) // inside block rule, the rules are separated by a space(s)
 	if err != nil {
 		return nil, fmt.Errorf("missing block open rule: %s", err)
 	}
@@ -220,7 +204,10 @@ func inBlock(grammar *Grammar, name string, charstream ICharstream) (*BlockRule,
 	cs.SkipSpaces()
 	char := cs.Peek()
 	if char != negationChar { // must be the escape rule or close rule
-		rule, err := grammar.parse(name, cs, []rune{' ', blockCloseSymbol, blockVirtualClose})
+		if err := checkNotPredicate(cs); err != nil {
+			return nil, err
+		}
+		rule, err := grammar.parse(name, cs, []rune{' ', '\n', blockCloseSymbol, blockVirtualClose})
 		if err != nil {
 			return nil, err
 		}
@@ -250,7 +237,7 @@ func inBlock(grammar *Grammar, name string, charstream ICharstream) (*BlockRule,
 			break
 		}
 		cs.Next() // skip the negationChar
-		excludeRule, err := grammar.parse(name, cs, []rune{' ', blockCloseSymbol, blockVirtualClose})
+		excludeRule, err := grammar.parse(name, cs, []rune{' ', '\n', blockCloseSymbol, blockVirtualClose})
 		if err != nil {
 			return nil, err
 		}
@@ -258,6 +245,9 @@ func inBlock(grammar *Grammar, name string, charstream ICharstream) (*BlockRule,
 	}
 
 	// now the close rule
+	if err := checkNotPredicate(cs); err != nil {
+		return nil, err
+	}
 	closeRule, err := grammar.parse(name, cs, []rune{blockCloseSymbol, blockVirtualClose})
 	if err != nil {
 		return nil, err
@@ -274,3 +264,21 @@ func inBlock(grammar *Grammar, name string, charstream ICharstream) (*BlockRule,
 	}
 	return block, nil
 }
+
+// checkNotPredicate reports a '!' predicate at the top level of a block, where '!' is taken as the
+// virtual close. The predicate must be put in a group, like ( !rule ).
+func checkNotPredicate(cs ICharstream) error {
+	cs.SkipSpaces()
+	if cs.Peek() != blockVirtualClose {
+		return nil
+	}
+	cursor := cs.Cursor()
+	cs.Next()
+	cs.SkipSpaces()
+	next := cs.Peek()
+	cs.Seek(cursor)
+	if next == blockCloseSymbol {
+		return nil
+	}
+	return fmt.Errorf("'%c' in a block is the virtual close, put a '%c' predicate in a group like ( %crule )", blockVirtualClose, NotPredicateSymbol, NotPredicateSymbol)
+}
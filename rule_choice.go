@@ -32,7 +32,98 @@ func (inst *ChoiceRule) desc() string {
 }
 
 func (inst *ChoiceRule) Eval(grammar *Grammar, charstream ICharstream, flagLeadingSpaces int) *EvalResult {
+	if !grammar.noDispatch {
+		if dispatch := grammar.Analysis().dispatch[inst]; dispatch != nil {
+			return inst.evalDispatched(grammar, charstream, flagLeadingSpaces, dispatch)
+		}
+	}
+	return inst.evalAlternatives(grammar, charstream, flagLeadingSpaces, nil, nil, nil)
+}
+
+// evalDispatched evaluates only the alternatives that may start with the next char. A choice of
+// literals is matched by the trie walk instead, without evaluating the literals. A failure or a
+// match using no char is evaluated again with all alternatives, so the failures of the others are
+// recorded as usual, and so is an ambiguity.
+func (inst *ChoiceRule) evalDispatched(grammar *Grammar, charstream ICharstream, flagLeadingSpaces int, dispatch *choiceDispatch) *EvalResult {
+	start := charstream.Cursor()
+	char := charstream.Peek()
+	next, cursor := char, start
+	if grammar.skipRule != "" || IsWhiteSpace(char) {
+		// the alternatives reuse the skip rather than evaluating the skip rule again
+		grammar.skip(charstream)
+		next, cursor = charstream.Peek(), charstream.Cursor()
+		charstream.Seek(start)
+	}
+	if char == EOFChar || next == EOFChar {
+		return inst.evalAlternatives(grammar, charstream, flagLeadingSpaces, nil, nil, nil)
+	}
+	if dispatch.trie != nil {
+		if evalResult := inst.evalTrie(charstream, start, cursor, flagLeadingSpaces, dispatch.trie); evalResult != nil {
+			return evalResult
+		}
+		charstream.Seek(start)
+		return inst.evalAlternatives(grammar, charstream, flagLeadingSpaces, nil, nil, nil)
+	}
+	candidates := dispatch.candidates(char, next)
+	results := make([]*EvalResult, len(dispatch.firsts))
+	if len(candidates) > 0 {
+		evalResult := inst.evalAlternatives(grammar, charstream, flagLeadingSpaces, dispatch, candidates, results)
+		if evalResult.Node != nil && evalResult.End > cursor {
+			return evalResult
+		}
+		charstream.Seek(start)
+	}
+	return inst.evalAlternatives(grammar, charstream, flagLeadingSpaces, nil, nil, results)
+}
+
+// evalTrie matches a choice of literals by the trie walk, and builds the nodes as the evaluation
+// of the alternatives would. It returns nil if the choice is not matched, or the match is ambiguous.
+func (inst *ChoiceRule) evalTrie(charstream ICharstream, start int, cursor int, flagLeadingSpaces int, trie *keywordTrie) *EvalResult {
+	matchStart := start
+	if trie.skips(flagLeadingSpaces) {
+		matchStart = cursor
+	}
+	charstream.Seek(matchStart)
+	match, found := trie.longest(trie.match(charstream))
+	if !found {
+		return nil
+	}
+	// a string result is not sticky, a chars one is, whether it matches or not
+	sticky := !trie.strings
+	literal := trie.literals[match.alt]
+	literalNode := &Node{
+		RuleType:  literal.ruleType,
+		RuleName:  literal.rule.name,
+		Tokenized: literal.rule.tokenized,
+		Virtual:   literal.rule.virtual,
+		NonData:   literal.rule.nondata,
+		Sticky:    sticky,
+		Position:  charstream.PositionLookup(matchStart),
+		Chars:     readChars(charstream, matchStart, match.end),
+	}
+	node := &Node{
+		RuleType:   TypeChoice,
+		RuleName:   inst.name,
+		Tokenized:  inst.tokenized,
+		Virtual:    inst.virtual,
+		NonData:    inst.nondata,
+		Sticky:     sticky,
+		Position:   literalNode.Position,
+		ChildNodes: []*Node{literalNode},
+	}
+	charstream.Seek(match.end)
+	return &EvalResult{Node: node, Start: start, End: match.end, Sticky: sticky}
+}
+
+// evalAlternatives evaluates the alternatives group by group. With a dispatch table, only the
+// candidates are evaluated, the others are taken as failed. The results of the alternatives are
+// kept in results if it's not nil, and reused if they are there already.
+func (inst *ChoiceRule) evalAlternatives(grammar *Grammar, charstream ICharstream, flagLeadingSpaces int,
+	dispatch *choiceDispatch, candidates []int, results []*EvalResult) *EvalResult {
+	start := charstream.Cursor()
 	evalResult := &EvalResult{
+		Start:  start,
+		End:    start,
 		Sticky: false,
 	}
 	node := &Node{
@@ -42,29 +133,42 @@ func (inst *ChoiceRule) Eval(grammar *Grammar, charstream ICharstream, flagLeadi
 		Virtual:   inst.virtual,
 		NonData:   inst.nondata,
 	}
-	cs := charstream
 	sticky := true
 	var resultsMatched []*EvalResult
 	var resultFound *EvalResult
 	var maxErr error
 	var maxErrCursor int
-	//startPos := charstream.Position()
+	i := -1 // number of the alternative
 	for _, group := range inst.groups {
 		resultsMatched = nil
 		resultFound = nil
 		for _, rule := range group {
-			cs = newCharstreamPrepend(charstream, evalResult.CharsRead)
-			result := rule.Eval(grammar, cs, flagLeadingSpaces)
+			i++
+			if dispatch != nil {
+				if len(candidates) == 0 || candidates[0] != i {
+					// it can't start with the next char, it would fail without using any char
+					sticky = sticky && dispatch.failSticky[i]
+					continue
+				}
+				candidates = candidates[1:]
+			}
+			charstream.Seek(start) // every choice is evaluated from the same cursor
+			var result *EvalResult
+			if results != nil && results[i] != nil {
+				result = results[i]
+			} else {
+				result = rule.Eval(grammar, charstream, flagLeadingSpaces)
+				if results != nil {
+					results[i] = result
+				}
+			}
 			if !result.Sticky { // as long as one of the choices is non-sticky, the result should be non-sticky
 				sticky = false
 			}
-			if len(evalResult.CharsRead) < len(result.CharsRead) {
-				evalResult.CharsRead = result.CharsRead
-			}
 			if result.Node != nil {
 				resultsMatched = append(resultsMatched, result)
 			} else {
-				if result.ErrIdx > maxErrCursor {
+				if maxErr == nil || result.ErrIdx > maxErrCursor {
 					maxErrCursor = result.ErrIdx
 					maxErr = result.Error
 				}
@@ -99,6 +203,7 @@ func (inst *ChoiceRule) Eval(grammar *Grammar, charstream ICharstream, flagLeadi
 					buf.WriteString(fmt.Sprintf("\t\n%s: %s", resultFound.Node.RuleName, string(resultFound.Node.Text())))
 					buf.WriteString(fmt.Sprintf("\t\n%s: %s", result.Node.RuleName, string(result.Node.Text())))
 					evalResult.Error = errors.New(buf.String())
+					charstream.Seek(start)
 					return evalResult
 				}
 				maxUsed = countCharsUsed
@@ -113,12 +218,12 @@ func (inst *ChoiceRule) Eval(grammar *Grammar, charstream ICharstream, flagLeadi
 		node.Sticky = evalResult.Sticky
 		node.Position = resultFound.Node.Position
 		evalResult.Node = node
-		evalResult.CharsUnused = evalResult.CharsRead[resultFound.countCharsUsed():]
+		evalResult.End = resultFound.End
 	} else {
-		evalResult.CharsUnused = evalResult.CharsRead
 		evalResult.ErrIdx = maxErrCursor
 		evalResult.Error = fmt.Errorf("%s: %s", inst.desc(), maxErr)
 	}
+	charstream.Seek(evalResult.End)
 	return evalResult
 }
 
@@ -128,17 +233,21 @@ func inChoice(grammar *Grammar, name string, firstRule IRule, cs ICharstream) (*
 	groups := [][]IRule{}
 EXIT:
 	for {
+		// a choice may go on in the following lines, after comments
+		cursor := cs.Cursor()
+		skipSpacesAndComments(cs)
 		char := cs.Peek()
 		switch char {
-		case ' ': // ignore space
-			cs.Next()
-			continue
 		case ChoiceSymbol:
 			cs.Next()
 			rule, err := grammar.parseOne(name, cs)
 			if err != nil {
 				return nil, err
 			}
+			rule, err = inDifferences(grammar, name, rule, cs)
+			if err != nil {
+				return nil, err
+			}
 			rules = append(rules, rule)
 		case ChoiceOrderSymbol: // time to create a new group
 			if len(rules) == 0 {
@@ -151,8 +260,14 @@ EXIT:
 			if err != nil {
 				return nil, err
 			}
+			rule, err = inDifferences(grammar, name, rule, cs)
+			if err != nil {
+				return nil, err
+			}
 			rules = append(rules, rule)
 		default:
+			// the spaces are left to the rule after the choice, they may terminate it
+			cs.Seek(cursor)
 			break EXIT
 		}
 	}
@@ -165,6 +280,29 @@ EXIT:
 	return ruleChoice, nil
 }
 
+// skipSpacesAndComments skips the white spaces and the `//` comments to the end of the line
+func skipSpacesAndComments(cs ICharstream) {
+	for {
+		char := cs.Peek()
+		if IsWhiteSpace(char) {
+			cs.Next()
+			continue
+		}
+		if char != '/' {
+			return
+		}
+		cursor := cs.Cursor()
+		cs.Next()
+		if cs.Peek() != '/' {
+			cs.Seek(cursor)
+			return
+		}
+		for char != '\n' && char != EOFChar {
+			char = cs.Next()
+		}
+	}
+}
+
 func (inst *ChoiceRule) String() string {
 	var buf strings.Builder
 
@@ -25,7 +25,10 @@ func (inst *ConcatenateRule) desc() string {
 }
 
 func (inst *ConcatenateRule) Eval(grammar *Grammar, charstream ICharstream, flagLeadingSpaces int) *EvalResult {
+	start := charstream.Cursor()
 	evalResult := &EvalResult{
+		Start:  start,
+		End:    start,
 		Sticky: true, // will change to false if any of the child result is non-sticky
 	}
 	node := &Node{
@@ -35,31 +38,10 @@ func (inst *ConcatenateRule) Eval(grammar *Grammar, charstream ICharstream, flag
 		Virtual:   inst.virtual,
 		NonData:   inst.nondata,
 	}
-	cs := charstream
 	for _, rule := range inst.rules {
-		cs = newCharstreamPrepend(cs, evalResult.CharsUnused)
-		result := rule.Eval(grammar, cs, flagLeadingSpaces)
-		//
-		// Update evalResult.CharsRead and evalResult.CharsUnused
-		// Note the result.CharsRead may be less or more than current evalResult.CharsUnused, and the evelResult.CharsRead
-		// contains all current evalResult.CharsUnused, if result.CharsRead less than current charsUnused, don't need to
-		// update evalResult.CharsRead, otherwise, need to add the extra chars to evalResult.CharsRead
-		// ┄┄┄┼┄┄┄┄┄┄┄┄┄┄┄┄┄┄┄┄┄┄┄┄────────────┤ evalResult.CharsRead
-		//    ├─────────────────────┬──────────┤ evalResult.CharsUnused
-		//                          ├──────────┤ unusedLeft = evalResult.CharsUnused - result.CharsUsed
-		//    ├─────────────────────┼─────────────────────┤ result.CharsRead
-		//                          ├─────────────────────┤ result.CharsUnused
-		if len(result.CharsRead) > len(evalResult.CharsUnused) {
-			extraChars := result.CharsRead[len(evalResult.CharsUnused):]
-			evalResult.CharsRead = append(evalResult.CharsRead, extraChars...)
-			evalResult.CharsUnused = result.CharsUnused
-		} else {
-			resultCharsUsed := result.charsUsed()
-			evalResult.CharsUnused = evalResult.CharsUnused[len(resultCharsUsed):] // unusedLeft
-			if len(evalResult.CharsUnused) < len(resultCharsUsed) {
-				evalResult.CharsUnused = result.CharsUnused
-			}
-		}
+		// each rule leaves the charstream at the end of the chars it used, so the next rule
+		// continues right from there
+		result := rule.Eval(grammar, charstream, flagLeadingSpaces)
 
 		if !result.Sticky {
 			evalResult.Sticky = false
@@ -67,7 +49,7 @@ func (inst *ConcatenateRule) Eval(grammar *Grammar, charstream ICharstream, flag
 
 		if result.Node == nil {
 			// one of the rule doesn't match, resulting this rule does not match
-			evalResult.CharsUnused = evalResult.CharsRead
+			charstream.Seek(start)
 			evalResult.Error = fmt.Errorf("%s: %s", inst.desc(), result.Error)
 			evalResult.ErrIdx = result.ErrIdx
 			return evalResult
@@ -77,9 +59,9 @@ func (inst *ConcatenateRule) Eval(grammar *Grammar, charstream ICharstream, flag
 			node.Position = result.Node.Position
 		}
 
-		// option node should be treated specially to decide whether or not next eval should skip leading spaces
-		// when option rule doesn't match, the hintSkipLeadingSpaces should remain the same
-		if result.Node.RuleType != TypeOption ||
+		// option and predicate node should be treated specially to decide whether or not next eval should skip
+		// leading spaces, when they use no chars, the hintSkipLeadingSpaces should remain the same
+		if (result.Node.RuleType != TypeOption && result.Node.RuleType != TypePredicate) ||
 			(len(result.Node.ChildNodes) > 0 || len(result.Node.Chars) > 0) {
 			// it's not an option node, or matched
 			if result.Sticky {
@@ -90,6 +72,7 @@ func (inst *ConcatenateRule) Eval(grammar *Grammar, charstream ICharstream, flag
 		}
 
 		node.ChildNodes = append(node.ChildNodes, result.Node)
+		evalResult.End = result.End
 	}
 
 	// all child rules matched
@@ -0,0 +1,128 @@
+package xbnf
+
+import (
+	"fmt"
+	"strings"
+)
+
+// DifferenceSymbol is the exception operator, `a -- b` matches a but not b. It's a pair of
+// range symbols, so it must be separated from a char rule by space(s).
+const DifferenceSymbol = "--"
+
+// DifferenceRule matches if its rule matches, and its excluded rule doesn't match the same text.
+type DifferenceRule struct {
+	ruleBase
+	rule     IRule
+	excluded IRule
+}
+
+func (inst *DifferenceRule) desc() string {
+	if inst.name != "" {
+		return inst.name
+	}
+	return inst.rule.desc() + " but not " + inst.excluded.desc()
+}
+
+// Eval evaluates both the rule and the excluded rule at the same cursor. The match of the rule is
+// rejected if the excluded rule uses the same chars.
+func (inst *DifferenceRule) Eval(grammar *Grammar, charstream ICharstream, flagLeadingSpaces int) *EvalResult {
+	start := charstream.Cursor()
+	evalResult := inst.rule.Eval(grammar, charstream, flagLeadingSpaces)
+	if evalResult.Node == nil {
+		evalResult.Error = fmt.Errorf("%s: %s", inst.desc(), evalResult.Error)
+		return evalResult
+	}
+	charstream.Seek(start)
+	// the excluded rule is expected not to match, its failures are not reported
+	grammar.silence(true)
+	excludedResult := inst.excluded.Eval(grammar, charstream, flagLeadingSpaces)
+	grammar.silence(false)
+	if excludedResult.Node != nil && excludedResult.End == evalResult.End {
+		charstream.Seek(start)
+		result := &EvalResult{Start: start, End: start, Sticky: evalResult.Sticky}
+		result.Error = fmt.Errorf("%s: unexpected %s", inst.desc(), inst.excluded.desc())
+		result.ErrIdx = start
+		grammar.expect(charstream, result.ErrIdx, inst.desc())
+		return result
+	}
+	node := &Node{
+		RuleType:  TypeDifference,
+		RuleName:  inst.name,
+		Tokenized: inst.tokenized,
+		Virtual:   inst.virtual,
+		NonData:   inst.nondata,
+		Sticky:    evalResult.Sticky,
+		Position:  evalResult.Node.Position,
+	}
+	node.ChildNodes = append(node.ChildNodes, evalResult.Node)
+	evalResult.Node = node
+	charstream.Seek(evalResult.End)
+	return evalResult
+}
+
+// inDifference expects the 1st non-space chars be "--". The excluded rule is the single rule
+// following the operator, use a group for a sequence of rules.
+func inDifference(grammar *Grammar, name string, rule IRule, cs ICharstream) (*DifferenceRule, error) {
+	for IsWhiteSpace(cs.Peek()) {
+		cs.Next()
+	}
+	for _, symbol := range DifferenceSymbol {
+		if cs.Next() != symbol {
+			return nil, fmt.Errorf("difference operator must be '%s'", DifferenceSymbol)
+		}
+	}
+	excluded, err := grammar.parseOne(name, cs)
+	if err != nil {
+		return nil, err
+	}
+	difference := &DifferenceRule{}
+	difference.rule = rule
+	difference.excluded = excluded
+	return difference, nil
+}
+
+// inDifferences wraps the rule in the difference rules following it, if any, such as the
+// alternative `b -- c` of the choice `a | b -- c`, so "--" binds tighter than a choice. Nothing
+// is consumed if the rule is not followed by "--".
+func inDifferences(grammar *Grammar, name string, rule IRule, cs ICharstream) (IRule, error) {
+	for {
+		cursor := cs.Cursor()
+		for IsWhiteSpace(cs.Peek()) {
+			cs.Next()
+		}
+		if cs.Peek() != CharRangeSymbol {
+			cs.Seek(cursor)
+			return rule, nil
+		}
+		difference, err := inDifference(grammar, name, rule, cs)
+		if err != nil {
+			return nil, err
+		}
+		rule = difference
+	}
+}
+
+func (inst *DifferenceRule) String() string {
+	var buf strings.Builder
+	annotations := inst.annotation()
+	if len(annotations) > 0 {
+		buf.WriteString(string(annotations))
+		buf.WriteRune(GroupOpenSymbol)
+	}
+	buf.WriteString(inst.rule.String())
+	buf.WriteString(" " + DifferenceSymbol + " ")
+	buf.WriteString(inst.excluded.String())
+	if len(annotations) > 0 {
+		buf.WriteRune(GroupCloseSymbol)
+	}
+	return buf.String()
+}
+
+func (inst *DifferenceRule) StringWithIndent(indent string) string {
+	var buf strings.Builder
+	buf.WriteString("difference:")
+	buf.WriteString(fmt.Sprintf("\n%s", inst.rule.StringWithIndent(indent)))
+	buf.WriteString(fmt.Sprintf("\n%s", inst.excluded.StringWithIndent(indent)))
+	result := buf.String()
+	return strings.ReplaceAll(result, "\n", "\n"+indent)
+}
@@ -32,11 +32,14 @@ func (inst *EOFRule) StringWithIndent(indent string) string {
 }
 
 func (inst *EOFRule) Eval(grammar *Grammar, charstream ICharstream, flagLeadingSpaces int) *EvalResult {
+	start := charstream.Cursor()
 	evalResult := &EvalResult{
+		Start:  start,
+		End:    start,
 		Sticky: true,
 	}
 	if flagLeadingSpaces == 1 {
-		evalResult.CharsRead = charstream.SkipSpaces()
+		grammar.skip(charstream)
 	}
 	if EOFChar == charstream.Peek() {
 		evalResult.Node = &Node{
@@ -49,10 +52,12 @@ func (inst *EOFRule) Eval(grammar *Grammar, charstream ICharstream, flagLeadingS
 			Chars:     []rune{EOFChar},
 			Position:  charstream.Position(),
 		}
+		evalResult.End = charstream.Cursor()
 	} else {
-		evalResult.CharsUnused = evalResult.CharsRead
 		evalResult.Error = fmt.Errorf("missing EOF")
 		evalResult.ErrIdx = charstream.Cursor()
+		grammar.expect(charstream, evalResult.ErrIdx, inst.desc())
+		charstream.Seek(start)
 	}
 
 	return evalResult
@@ -27,13 +27,12 @@ func (inst *GroupRule) Eval(grammar *Grammar, charstream ICharstream, flagLeadin
 	}
 	evalResult := inst.rule.Eval(grammar, charstream, flagLeadingSpaces)
 	if evalResult.Node == nil {
-		evalResult.CharsUnused = evalResult.CharsRead
 		return evalResult
 	}
 	node.Sticky = evalResult.Sticky
 	node.ChildNodes = append(node.ChildNodes, evalResult.Node)
-	evalResult.Node = node
 	node.Position = evalResult.Node.Position
+	evalResult.Node = node
 	return evalResult
 }
 
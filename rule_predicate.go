@@ -0,0 +1,113 @@
+package xbnf
+
+import (
+	"fmt"
+	"strings"
+)
+
+// PredicateRule is a syntactic predicate, it evaluates its rule without consuming any char. A
+// lookahead (&rule) matches if the rule matches, a negative lookahead (!rule) matches if the rule
+// doesn't match.
+type PredicateRule struct {
+	ruleBase
+	rule    IRule
+	negated bool
+}
+
+func (inst *PredicateRule) symbol() rune {
+	if inst.negated {
+		return NotPredicateSymbol
+	}
+	return AndPredicateSymbol
+}
+
+func (inst *PredicateRule) desc() string {
+	if inst.name != "" {
+		return inst.name
+	}
+	if inst.negated {
+		return "not " + inst.rule.desc()
+	}
+	return inst.rule.desc()
+}
+
+// Eval with predicate rule produces an empty node when it matches. The charstream is always
+// left at where it starts.
+func (inst *PredicateRule) Eval(grammar *Grammar, charstream ICharstream, flagLeadingSpaces int) *EvalResult {
+	start := charstream.Cursor()
+	evalResult := &EvalResult{
+		Start:  start,
+		End:    start,
+		Sticky: true, // no char is used, it doesn't change the stickiness of its neighbors
+	}
+	if inst.negated {
+		// the rule is expected not to match, its failures are not reported
+		grammar.silence(true)
+	}
+	result := inst.rule.Eval(grammar, charstream, flagLeadingSpaces)
+	if inst.negated {
+		grammar.silence(false)
+	}
+	charstream.Seek(start)
+	if (result.Node != nil) == inst.negated {
+		if inst.negated {
+			evalResult.Error = fmt.Errorf("%s: unexpected %s", inst.desc(), inst.rule.desc())
+			evalResult.ErrIdx = start
+			grammar.expect(charstream, evalResult.ErrIdx, inst.desc())
+		} else {
+			evalResult.Error = fmt.Errorf("%s: %s", inst.desc(), result.Error)
+			evalResult.ErrIdx = result.ErrIdx
+		}
+		return evalResult
+	}
+	evalResult.Node = &Node{
+		RuleType:  TypePredicate,
+		RuleName:  inst.name,
+		Tokenized: inst.tokenized,
+		Virtual:   true,
+		NonData:   true,
+		Position:  charstream.Position(),
+	}
+	return evalResult
+}
+
+// This function expects '&' or '!' as the 1st char in the input charstream. The predicate
+// applies to the single rule following the symbol, use a group for a sequence of rules.
+func inPredicate(grammar *Grammar, name string, cs ICharstream) (*PredicateRule, error) {
+	predicate := &PredicateRule{}
+	symbol := cs.Next()
+	if symbol != AndPredicateSymbol && symbol != NotPredicateSymbol {
+		return nil, fmt.Errorf("predicate must start with '%c' or '%c'", AndPredicateSymbol, NotPredicateSymbol)
+	}
+	switch cs.Peek() {
+	case EOFChar, ' ', '\n', '\t', '\r':
+		return nil, fmt.Errorf("predicate symbol '%c' must be followed by a rule", symbol)
+	}
+	rule, err := grammar.parseOne(name, cs)
+	if err != nil {
+		return nil, err
+	}
+	predicate.rule = rule
+	predicate.negated = symbol == NotPredicateSymbol
+	return predicate, nil
+}
+
+func (inst *PredicateRule) String() string {
+	var buf strings.Builder
+	buf.WriteString(string(inst.annotation()))
+	buf.WriteRune(inst.symbol())
+	buf.WriteString(inst.rule.String())
+	return buf.String()
+}
+
+func (inst *PredicateRule) StringWithIndent(indent string) string {
+	var buf strings.Builder
+	if inst.negated {
+		buf.WriteString("negative lookahead:")
+	} else {
+		buf.WriteString("lookahead:")
+	}
+	buf.WriteString(fmt.Sprintf("\n%s", inst.rule.StringWithIndent(indent)))
+	result := buf.String()
+	return strings.ReplaceAll(result, "\n", "\n"+indent)
+}
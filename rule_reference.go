@@ -8,6 +8,7 @@ import (
 type ReferenceRule struct {
 	ruleBase
 	refName string
+	record  *RuleRecord // the rule referenced, resolved by Compile
 }
 
 func (inst *ReferenceRule) desc() string {
@@ -15,36 +16,30 @@ func (inst *ReferenceRule) desc() string {
 }
 
 func (inst *ReferenceRule) Eval(grammar *Grammar, charstream ICharstream, flagLeadingSpaces int) *EvalResult {
-	ruleRecord := grammar.GetRecord(inst.refName)
+	ruleRecord := inst.record
+	if ruleRecord == nil {
+		ruleRecord = grammar.GetRecord(inst.refName)
+	}
 	if ruleRecord == nil {
 		evalResult := &EvalResult{
 			Error: fmt.Errorf("rule '%s' not defined", inst),
 		}
 		return evalResult
 	}
-	evalResult := ruleRecord.rule.Eval(grammar, charstream, flagLeadingSpaces)
-	if evalResult.Node != nil {
+	evalResult := grammar.evalRecord(ruleRecord, charstream, flagLeadingSpaces)
+	if evalResult.Node != nil && (inst.tokenized || inst.virtual || inst.nondata) {
+		// the node may be cached and shared, annotate a copy of it
+		node := *evalResult.Node
 		if inst.tokenized {
-			if evalResult.Node.Tokenized { // tokenized && tokenized is non-tokenized
-				evalResult.Node.Tokenized = false
-			} else {
-				evalResult.Node.Tokenized = true
-			}
+			node.Tokenized = !node.Tokenized // tokenized && tokenized is non-tokenized
 		}
 		if inst.virtual {
-			if evalResult.Node.Virtual { // virtual && virtual is non-virtual
-				evalResult.Node.Virtual = false
-			} else {
-				evalResult.Node.Virtual = true
-			}
+			node.Virtual = !node.Virtual // virtual && virtual is non-virtual
 		}
 		if inst.nondata {
-			if evalResult.Node.NonData { // nondata && nondata is data
-				evalResult.Node.NonData = false
-			} else {
-				evalResult.Node.NonData = true
-			}
+			node.NonData = !node.NonData // nondata && nondata is data
 		}
+		evalResult.Node = &node
 	}
 	return evalResult
 }
@@ -76,14 +71,30 @@ func inReference(grammar *Grammar, name string, cs ICharstream) (IRule, error) {
 			cs.Next()
 			continue
 		}
+		if char == NamespaceSymbol && isNamespaced(cs) { // a qualified name such as common.integer
+			buf.WriteRune(char)
+			cs.Next()
+			continue
+		}
 		break
 	}
 	ruleName := buf.String()
 	if ruleName == "EOF" {
 		return EOF(), nil
 	}
+	ruleName = grammar.loading.qualify(ruleName)
 	grammar.AddUsage(ruleName, name)
 	rule := &ReferenceRule{}
 	rule.refName = ruleName
 	return rule, nil
 }
+
+// isNamespaced checks whether the '.' at the cursor is followed by a rule name, rather than being
+// an any char rule.
+func isNamespaced(cs ICharstream) bool {
+	start := cs.Cursor()
+	cs.Next()
+	char := cs.Peek()
+	cs.Seek(start)
+	return (char >= 'a' && char <= 'z') || (char >= 'A' && char <= 'Z') || char == '_'
+}
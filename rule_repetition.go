@@ -15,6 +15,8 @@ type RepetitionRule struct {
 	// <min, max> means at least min times, and at most max times
 	min uint
 	max uint // 0 means unlimited or infinity
+
+	explicit bool // the min and max are specified in '<' and '>'
 }
 
 func (inst *RepetitionRule) desc() string {
@@ -33,7 +35,10 @@ func (inst *RepetitionRule) desc() string {
 // RepetitionRule Eval will always returns a result with a RepetitionNode, which may contain
 // 0 or more children INode
 func (inst *RepetitionRule) Eval(grammar *Grammar, charstream ICharstream, flagLeadingSpaces int) *EvalResult {
+	start := charstream.Cursor()
 	evalResult := &EvalResult{
+		Start:  start,
+		End:    start,
 		Sticky: true, // will change to false if any of the child result is non-sticky
 	}
 	node := &Node{
@@ -43,45 +48,35 @@ func (inst *RepetitionRule) Eval(grammar *Grammar, charstream ICharstream, flagL
 		Virtual:   inst.virtual,
 		NonData:   inst.nondata,
 	}
-	cs := charstream
 	var nodes []*Node // all found matched nodes
 	rule := inst.rule
 	for {
-		cs = newCharstreamPrepend(cs, evalResult.CharsUnused)
-		if cs.Peek() == EOFChar {
+		if charstream.Peek() == EOFChar {
 			break
 		}
-		result := rule.Eval(grammar, cs, flagLeadingSpaces)
-		//
-		// Update evalResult.CharsRead and evalResult.CharsUnused
-		// Note the result.CharsRead may be less or more than current evalResult.CharsUnused, and the evelResult.CharsRead
-		// contains all current evalResult.CharsUnused, if result.CharsRead less than current charsUnused, don't need to
-		// update evalResult.CharsRead, otherwise, need to add the extra chars to evalResult.CharsRead
-		// ┄┄┄┼┄┄┄┄┄┄┄┄┄┄┄┄┄┄┄┄┄┄┄┄────────────┤ evalResult.CharsRead
-		//    ├─────────────────────┬──────────┤ evalResult.CharsUnused
-		//                          ├──────────┤ unusedLeft = evalResult.CharsUnused - result.CharsUsed
-		//    ├─────────────────────┼─────────────────────┤ result.CharsRead
-		//                          ├─────────────────────┤ result.CharsUnused
-		if len(result.CharsRead) > len(evalResult.CharsUnused) {
-			extraChars := result.CharsRead[len(evalResult.CharsUnused):]
-			evalResult.CharsRead = append(evalResult.CharsRead, extraChars...)
-			evalResult.CharsUnused = result.CharsUnused
-		} else {
-			resultCharsUsed := result.charsUsed()
-			evalResult.CharsUnused = evalResult.CharsUnused[len(resultCharsUsed):] // unusedLeft
-			if len(evalResult.CharsUnused) < len(resultCharsUsed) {
-				evalResult.CharsUnused = result.CharsUnused
-			}
+		cursor := charstream.Cursor()
+		if err := grammar.checkLimits(charstream, nil); err != nil {
+			evalResult.Error = err
+			evalResult.ErrIdx = cursor
+			charstream.Seek(start)
+			return evalResult
 		}
+		result := rule.Eval(grammar, charstream, flagLeadingSpaces)
 
 		if !result.Sticky {
 			evalResult.Sticky = false //change to false if any of the child result is non-sticky
 		}
 
+		if result.Node == nil {
+			if errNode := grammar.recoverElement(charstream, cursor, flagLeadingSpaces); errNode != nil {
+				// the element is broken rather than missing, it's skipped to the next sync rule match
+				result = &EvalResult{Node: errNode, Start: cursor, End: charstream.Cursor()}
+			}
+		}
 		if result.Node == nil {
 			// we didn't find a match, should prepare the evalResult and exist
 			evalResult.Error = result.Error
-			evalResult.ErrIdx = charstream.Cursor()
+			evalResult.ErrIdx = result.ErrIdx
 			break
 		}
 
@@ -91,15 +86,21 @@ func (inst *RepetitionRule) Eval(grammar *Grammar, charstream ICharstream, flagL
 
 		// got another match
 		nodes = append(nodes, result.Node)
+		evalResult.End = result.End
 		if inst.max > 0 && len(nodes) == int(inst.max) { // found max number of matches
 			break
 		}
+		if result.End == cursor {
+			// the match uses no char, it would match again and again at the same cursor
+			break
+		}
 	}
 
 	if len(nodes) < int(inst.min) {
 		// eval fails, didn't found enough repetitions
 		// all chars read should be unused
-		evalResult.CharsUnused = evalResult.CharsRead
+		charstream.Seek(start)
+		evalResult.End = start
 		if evalResult.Error == nil {
 			evalResult.Error = fmt.Errorf("%s: %d less than minimal %d", inst.desc(), len(nodes), inst.min)
 			evalResult.ErrIdx = charstream.Cursor()
@@ -107,6 +108,7 @@ func (inst *RepetitionRule) Eval(grammar *Grammar, charstream ICharstream, flagL
 		return evalResult
 	}
 
+	charstream.Seek(evalResult.End)
 	node.ChildNodes = nodes
 	evalResult.Node = node
 	node.Sticky = evalResult.Sticky
@@ -159,6 +161,7 @@ func inRepetition(grammar *Grammar, name string, cs ICharstream) (*RepetitionRul
 		}
 		reps.min = min
 		reps.max = max
+		reps.explicit = true
 	}
 	reps.rule = rule
 	return reps, nil
@@ -0,0 +1,42 @@
+package xbnf
+
+import (
+	"fmt"
+)
+
+// TerminalAnyRule matches any char, but EOF
+type TerminalAnyRule struct {
+	ruleBase
+}
+
+func (inst *TerminalAnyRule) desc() string {
+	if inst.name == "" {
+		return "any char"
+	}
+	return inst.name
+}
+
+func (inst *TerminalAnyRule) matches(char rune) bool {
+	return true
+}
+
+func (inst *TerminalAnyRule) Eval(grammar *Grammar, charstream ICharstream, flagLeadingSpaces int) *EvalResult {
+	return evalCharClass(inst, TypeAny, grammar, charstream, flagLeadingSpaces)
+}
+
+// Returns the rule definition string in xbnf format
+func (inst *TerminalAnyRule) String() string {
+	return string(inst.annotation()) + string(AnyCharSymbol)
+}
+
+func (inst *TerminalAnyRule) StringWithIndent(indent string) string {
+	return fmt.Sprintf("%s:%s", TypeAny, inst.String())
+}
+
+// inAny expects the 1st char in the input charstream is a '.'
+func inAny(cs ICharstream) (*TerminalAnyRule, error) {
+	if cs.Next() != AnyCharSymbol {
+		return nil, fmt.Errorf("any char must be '%c'", AnyCharSymbol)
+	}
+	return &TerminalAnyRule{}, nil
+}
@@ -9,21 +9,29 @@ type TerminalCharRule struct {
 	ruleBase
 	text             rune
 	definedAsUnicode bool
+	caseInsensitive  bool
 }
 
 func (inst *TerminalCharRule) desc() string {
 	if inst.name == "" {
+		if inst.caseInsensitive {
+			return string(CaseInsensitiveSymbol) + "'" + string(inst.text) + "'"
+		}
 		return "'" + string(inst.text) + "'"
 	}
 	return inst.name
 }
 func (inst *TerminalCharRule) Eval(grammar *Grammar, charstream ICharstream, flagLeadingSpaces int) *EvalResult {
+	start := charstream.Cursor()
 	evalResult := &EvalResult{
+		Start:  start,
+		End:    start,
 		Sticky: true,
 	}
 	if charstream.Peek() == EOFChar {
 		evalResult.Error = fmt.Errorf("missing %s at EOF", inst.desc())
 		evalResult.ErrIdx = charstream.Cursor()
+		grammar.expect(charstream, evalResult.ErrIdx, inst.desc())
 		return evalResult
 	}
 	node := &Node{
@@ -38,44 +46,49 @@ func (inst *TerminalCharRule) Eval(grammar *Grammar, charstream ICharstream, fla
 	startPos := charstream.Position()
 
 	if flagLeadingSpaces == SUGGEST_SKIP {
-		skippedSpaces := charstream.SkipSpaces()
-		evalResult.CharsRead = append(evalResult.CharsRead, skippedSpaces...)
-		// inst.text may be a whitespace, so we need to check if it's among the skippedSpaces
+		skippedSpaces := grammar.skip(charstream)
+		// inst.text may be a whitespace, so we need to check if it's among the skippedSpaces.
+		// If it's not skipped, it may still be at the cursor, as the skip rule may not skip it.
 		if IsWhiteSpace(inst.text) && len(skippedSpaces) > 0 {
+			spacesStart := charstream.Cursor() - len(skippedSpaces)
 			for i, wspace := range skippedSpaces {
 				if wspace == inst.text {
 					node.Chars = append(node.Chars, inst.text)
-					node.Position = charstream.PositionLookup(charstream.Cursor() - len(skippedSpaces) + i)
+					node.Position = charstream.PositionLookup(spacesStart + i)
 					evalResult.Node = node
-					evalResult.CharsUnused = skippedSpaces[i+1:]
+					evalResult.End = spacesStart + i + 1
+					charstream.Seek(evalResult.End)
 					return evalResult
 				}
 			}
-			evalResult.CharsUnused = evalResult.CharsRead
-			evalResult.Error = fmt.Errorf("missing %s at %s", inst.desc(), startPos.String())
-			evalResult.ErrIdx = charstream.Cursor()
-			return evalResult
 		}
 	}
 
 	char := charstream.Peek()
-	if char != inst.text {
-		evalResult.CharsUnused = evalResult.CharsRead
+	if char != inst.text && !((inst.caseInsensitive || grammar.ignoreCase) && equalFold(char, inst.text)) {
 		evalResult.Error = fmt.Errorf("missing %s at %s", inst.desc(), startPos.String())
 		evalResult.ErrIdx = charstream.Cursor()
+		grammar.expect(charstream, evalResult.ErrIdx, inst.desc())
+		charstream.Seek(start)
 		return evalResult
 	}
 	node.Position = charstream.Position()
 	char = charstream.Next()
-	evalResult.CharsRead = append(evalResult.CharsRead, char)
 	node.Chars = append(node.Chars, char)
 	evalResult.Node = node
+	evalResult.End = charstream.Cursor()
 	return evalResult
 }
 
 // Returns the rule definition string in xbnf format
 func (inst *TerminalCharRule) String() string {
 	annotations := string(inst.annotation())
+	if inst.caseInsensitive {
+		annotations = annotations + string(CaseInsensitiveSymbol)
+		if inst.definedAsUnicode { // the prefix applies to quoted literals only
+			return fmt.Sprintf("%s'\\u%04X'", annotations, inst.text)
+		}
+	}
 	if inst.definedAsUnicode {
 		return fmt.Sprintf("%s\\u%04X", annotations, inst.text)
 	}
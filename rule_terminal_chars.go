@@ -7,23 +7,31 @@ import (
 
 type TerminalCharsRule struct {
 	ruleBase
-	text []rune
+	text            []rune
+	caseInsensitive bool
 }
 
 func (inst *TerminalCharsRule) desc() string {
 	if inst.name == "" {
+		if inst.caseInsensitive {
+			return string(CaseInsensitiveSymbol) + "'" + string(inst.text) + "'"
+		}
 		return "'" + string(inst.text) + "'"
 	}
 	return inst.name
 }
 
 func (inst *TerminalCharsRule) Eval(grammar *Grammar, charstream ICharstream, flagLeadingSpaces int) *EvalResult {
+	start := charstream.Cursor()
 	evalResult := &EvalResult{
+		Start:  start,
+		End:    start,
 		Sticky: true,
 	}
 	if charstream.Peek() == EOFChar {
 		evalResult.Error = fmt.Errorf("missing %s at EOF", inst.desc())
 		evalResult.ErrIdx = charstream.Cursor()
+		grammar.expect(charstream, evalResult.ErrIdx, inst.desc())
 		return evalResult
 	}
 	node := &Node{
@@ -41,42 +49,25 @@ func (inst *TerminalCharsRule) Eval(grammar *Grammar, charstream ICharstream, fl
 	text := inst.text
 	if flagLeadingSpaces == SUGGEST_SKIP {
 		leadingWSpaces := leadingWhiteSpace(text)
-		skippedWSpaces := charstream.SkipSpaces()
-		evalResult.CharsRead = append(evalResult.CharsRead, skippedWSpaces...)
-
-		if len(skippedWSpaces) < len(leadingWSpaces) {
-			// for sure not match
-			evalResult.CharsUnused = evalResult.CharsRead
-			evalResult.Error = fmt.Errorf("missing %s at %s", inst.desc(), startPos.String())
-			evalResult.ErrIdx = charstream.Cursor()
-			return evalResult
-		}
-		startCursor = startCursor + len(skippedWSpaces)
-		// now we need to check if the leadingWSpace matches the end of skippedWSpace
-		skippedWSpaces = skippedWSpaces[len(skippedWSpaces)-len(leadingWSpaces):]
-		for i, skippedWSpace := range skippedWSpaces {
-			if skippedWSpace != leadingWSpaces[i] {
-				// not match
-				evalResult.CharsUnused = evalResult.CharsRead
-				evalResult.Error = fmt.Errorf("missing %s at %s", inst.desc(), startPos.String())
-				evalResult.ErrIdx = charstream.Cursor()
-				return evalResult
-			}
-		}
-		// now the leadingWSpaces matched, check the rest of text
-		text = inst.text[len(leadingWSpaces):]
+		skippedWSpaces := grammar.skip(charstream)
+		startCursor = charstream.Cursor()
+		// the leading white spaces of the text may be skipped already, the rest must follow
+		text = inst.text[skippedLeadingSpaces(skippedWSpaces, leadingWSpaces):]
 	}
 
-	charsRead, succeeded := charstream.Match(text)
-	evalResult.CharsRead = append(evalResult.CharsRead, charsRead...)
+	matchStart := charstream.Cursor()
+	matched, succeeded := matchText(charstream, text, inst.caseInsensitive || grammar.ignoreCase)
 	if !succeeded {
-		evalResult.CharsUnused = evalResult.CharsRead
 		evalResult.Error = fmt.Errorf("missing %s at %s", inst.desc(), startPos.String())
-		evalResult.ErrIdx = charstream.Cursor()
+		evalResult.ErrIdx = matchStart
+		grammar.expect(charstream, evalResult.ErrIdx, inst.desc())
+		charstream.Seek(start)
 		return evalResult
 	}
+	evalResult.End = charstream.Cursor()
 	node.Position = charstream.PositionLookup(startCursor)
-	node.Chars = append(node.Chars, inst.text...)
+	node.Chars = append(node.Chars, inst.text[:len(inst.text)-len(text)]...) // leading spaces
+	node.Chars = append(node.Chars, matched...)
 	evalResult.Node = node
 	return evalResult
 }
@@ -88,6 +79,9 @@ func (inst *TerminalCharsRule) String() string {
 	if strings.ContainsRune(str, '\'') {
 		str = strings.ReplaceAll(str, "'", "\\'")
 	}
+	if inst.caseInsensitive {
+		return fmt.Sprintf("%s%c'%s'", annotations, CaseInsensitiveSymbol, str)
+	}
 	return fmt.Sprintf("%s'%s'", annotations, str)
 }
 
@@ -0,0 +1,186 @@
+package xbnf
+
+import (
+	"fmt"
+	"unicode"
+)
+
+// Symbols of the escapes of the char class terminals
+const (
+	ClassSymbol        = 'p' // \p{L} matches a char of an unicode category, script or property
+	NegatedClassSymbol = 'P' // \P{L} matches a char not in an unicode category, script or property
+	SetOpenSymbol      = '[' // \[a-z_] matches a char in the set, \[^a-z_] matches a char not in the set
+	SetCloseSymbol     = ']'
+	AnyCharSymbol      = '.' // matches any char
+)
+
+// charClass is a terminal rule that matches a single char of a class of chars
+type charClass interface {
+	IRule
+	matches(char rune) bool
+}
+
+// evalCharClass evaluates a char class rule in the same way as a range rule does, the node is of
+// the type of the rule.
+func evalCharClass(inst charClass, ruleType Type, grammar *Grammar, charstream ICharstream, flagLeadingSpaces int) *EvalResult {
+	start := charstream.Cursor()
+	evalResult := &EvalResult{
+		Start:  start,
+		End:    start,
+		Sticky: true,
+	}
+	if charstream.Peek() == EOFChar {
+		evalResult.Error = fmt.Errorf("missing %s at EOF", inst.desc())
+		evalResult.ErrIdx = charstream.Cursor()
+		grammar.expect(charstream, evalResult.ErrIdx, inst.desc())
+		return evalResult
+	}
+	node := &Node{
+		RuleType:  ruleType,
+		RuleName:  inst.Name(),
+		Tokenized: inst.IsTokenized(),
+		Virtual:   inst.IsVirtual(),
+		NonData:   inst.IsNonData(),
+		Sticky:    true,
+	}
+
+	if flagLeadingSpaces == SUGGEST_SKIP {
+		skippedWSpaces := grammar.skip(charstream)
+		spacesStart := charstream.Cursor() - len(skippedWSpaces)
+		for i, char := range skippedWSpaces {
+			if inst.matches(char) {
+				// matched
+				node.Chars = append(node.Chars, char)
+				node.Position = charstream.PositionLookup(spacesStart + i)
+				evalResult.Node = node
+				evalResult.End = spacesStart + i + 1
+				charstream.Seek(evalResult.End)
+				return evalResult
+			}
+		}
+	}
+
+	startPos := charstream.Position()
+
+	char := charstream.Peek()
+	if char != EOFChar && inst.matches(char) {
+		// matched
+		node.Position = startPos
+		char = charstream.Next()
+		node.Chars = append(node.Chars, char)
+		evalResult.Node = node
+		evalResult.End = charstream.Cursor()
+		return evalResult
+	}
+
+	evalResult.Error = fmt.Errorf("missing %s at %s", inst.desc(), startPos.String())
+	evalResult.ErrIdx = charstream.Cursor()
+	grammar.expect(charstream, evalResult.ErrIdx, inst.desc())
+	charstream.Seek(start)
+	return evalResult
+}
+
+// TerminalClassRule matches a char of an unicode general category (L, Nd...), script (Greek,
+// Han...) or property (White_Space...), or a char not in it if negated.
+type TerminalClassRule struct {
+	ruleBase
+	class   string
+	table   *unicode.RangeTable
+	negated bool
+}
+
+func (inst *TerminalClassRule) desc() string {
+	if inst.name == "" {
+		return inst.classString()
+	}
+	return inst.name
+}
+
+func (inst *TerminalClassRule) matches(char rune) bool {
+	return unicode.Is(inst.table, char) != inst.negated
+}
+
+func (inst *TerminalClassRule) Eval(grammar *Grammar, charstream ICharstream, flagLeadingSpaces int) *EvalResult {
+	return evalCharClass(inst, TypeClass, grammar, charstream, flagLeadingSpaces)
+}
+
+func (inst *TerminalClassRule) classString() string {
+	symbol := ClassSymbol
+	if inst.negated {
+		symbol = NegatedClassSymbol
+	}
+	return fmt.Sprintf("%c%c{%s}", EscapeSymbol, symbol, inst.class)
+}
+
+// Returns the rule definition string in xbnf format
+func (inst *TerminalClassRule) String() string {
+	return string(inst.annotation()) + inst.classString()
+}
+
+func (inst *TerminalClassRule) StringWithIndent(indent string) string {
+	return fmt.Sprintf("%s:%s", TypeClass, inst.String())
+}
+
+// inClass expects the 1st char in the input charstream is a 'p' or 'P', the leading '\' must
+// already be consumed.
+func inClass(cs ICharstream) (*TerminalClassRule, error) {
+	rule := &TerminalClassRule{}
+	symbol := cs.Next()
+	if symbol != ClassSymbol && symbol != NegatedClassSymbol {
+		return nil, fmt.Errorf("unicode class must start with '\\%c' or '\\%c'", ClassSymbol, NegatedClassSymbol)
+	}
+	if cs.Next() != '{' {
+		return nil, fmt.Errorf("unicode class name must be enclosed in '{}'")
+	}
+	var name []rune
+	for {
+		char := cs.Next()
+		if char == EOFChar {
+			return nil, fmt.Errorf("unicode class name must be enclosed in '{}'")
+		}
+		if char == '}' {
+			break
+		}
+		name = append(name, char)
+	}
+	table, err := unicodeTable(string(name))
+	if err != nil {
+		return nil, err
+	}
+	rule.class = string(name)
+	rule.table = table
+	rule.negated = symbol == NegatedClassSymbol
+	return rule, nil
+}
+
+// unicodeTable looks up the range table of an unicode category, script or property by name
+func unicodeTable(name string) (*unicode.RangeTable, error) {
+	if table, exists := unicode.Categories[name]; exists {
+		return table, nil
+	}
+	if table, exists := unicode.Scripts[name]; exists {
+		return table, nil
+	}
+	if table, exists := unicode.Properties[name]; exists {
+		return table, nil
+	}
+	return nil, fmt.Errorf("unknown unicode category, script or property '%s'", name)
+}
+
+// inEscape creates a terminal rule that starts with an escape char '\', such as an unicode
+// escape \u0041, an unicode class \p{L}, or a char set \[a-z].
+func inEscape(cs ICharstream) (IRule, error) {
+	start := cs.Cursor()
+	if cs.Next() != EscapeSymbol {
+		return nil, fmt.Errorf("escape must start with '%c'", EscapeSymbol)
+	}
+	switch cs.Peek() {
+	case ClassSymbol, NegatedClassSymbol:
+		return inClass(cs)
+	case SetOpenSymbol:
+		return inSet(cs)
+	default:
+		cs.Seek(start)
+		return inUnicode(cs)
+	}
+}
@@ -20,33 +20,38 @@ func (inst *TerminalRangeRule) desc() string {
 }
 
 func (inst *TerminalRangeRule) Eval(grammar *Grammar, charstream ICharstream, flagLeadingSpaces int) *EvalResult {
+	start := charstream.Cursor()
 	evalResult := &EvalResult{
+		Start:  start,
+		End:    start,
 		Sticky: true,
 	}
 	if charstream.Peek() == EOFChar {
 		evalResult.Error = fmt.Errorf("missing %s at EOF", inst.desc())
 		evalResult.ErrIdx = charstream.Cursor()
+		grammar.expect(charstream, evalResult.ErrIdx, inst.desc())
 		return evalResult
 	}
 	node := &Node{
-		RuleType:  TypeChars,
+		RuleType:  TypeRange,
 		RuleName:  inst.name,
 		Tokenized: inst.tokenized,
 		Virtual:   inst.virtual,
 		NonData:   inst.nondata,
 		Sticky:    true,
-		Position:  charstream.PositionLookup(charstream.Cursor() - 1),
 	}
 
 	if flagLeadingSpaces == SUGGEST_SKIP {
-		skippedWSpaces := charstream.SkipSpaces()
-		evalResult.CharsRead = append(evalResult.CharsRead, skippedWSpaces...)
+		skippedWSpaces := grammar.skip(charstream)
+		spacesStart := charstream.Cursor() - len(skippedWSpaces)
 		for i, char := range skippedWSpaces {
-			if inst.begin <= char && char >= inst.end {
+			if inst.begin <= char && char <= inst.end {
 				// matched
-				evalResult.CharsUnused = skippedWSpaces[i+1:]
 				node.Chars = append(node.Chars, char)
+				node.Position = charstream.PositionLookup(spacesStart + i)
 				evalResult.Node = node
+				evalResult.End = spacesStart + i + 1
+				charstream.Seek(evalResult.End)
 				return evalResult
 			}
 		}
@@ -57,16 +62,18 @@ func (inst *TerminalRangeRule) Eval(grammar *Grammar, charstream ICharstream, fl
 	char := charstream.Peek()
 	if inst.begin <= char && char <= inst.end {
 		// matched
+		node.Position = startPos
 		char = charstream.Next()
-		evalResult.CharsRead = append(evalResult.CharsRead, char)
 		node.Chars = append(node.Chars, char)
 		evalResult.Node = node
+		evalResult.End = charstream.Cursor()
 		return evalResult
 	}
 
-	evalResult.CharsUnused = evalResult.CharsRead
 	evalResult.Error = fmt.Errorf("missing %s at %s", inst.desc(), startPos.String())
 	evalResult.ErrIdx = charstream.Cursor()
+	grammar.expect(charstream, evalResult.ErrIdx, inst.desc())
+	charstream.Seek(start)
 	return evalResult
 }
 
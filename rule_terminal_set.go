@@ -0,0 +1,172 @@
+package xbnf
+
+import (
+	"fmt"
+	"strings"
+	"unicode"
+)
+
+// setItem is a char range or an unicode class in a char set
+type setItem struct {
+	begin rune
+	end   rune
+	class *TerminalClassRule // not nil if the item is an unicode class
+}
+
+func (inst *setItem) matches(char rune) bool {
+	if inst.class != nil {
+		return inst.class.matches(char)
+	}
+	return inst.begin <= char && char <= inst.end
+}
+
+func (inst *setItem) String() string {
+	if inst.class != nil {
+		return inst.class.classString()
+	}
+	if inst.begin == inst.end {
+		return setCharString(inst.begin)
+	}
+	return setCharString(inst.begin) + string(CharRangeSymbol) + setCharString(inst.end)
+}
+
+// setCharString returns a char as it's written in a char set, the special chars are escaped, and
+// the invisible chars are written as unicode escapes
+func setCharString(char rune) string {
+	switch char {
+	case EscapeSymbol, SetCloseSymbol, CharRangeSymbol, NegatedSymbol:
+		return string(EscapeSymbol) + string(char)
+	}
+	if !unicode.IsGraphic(char) || unicode.IsSpace(char) {
+		return fmt.Sprintf("\\u%04X", char)
+	}
+	return string(char)
+}
+
+// TerminalSetRule matches a char in a set of chars, or a char not in the set if negated. The set
+// is a union of chars, char ranges and unicode classes, for example \[a-zA-Z_\p{Greek}].
+type TerminalSetRule struct {
+	ruleBase
+	items   []*setItem
+	negated bool
+}
+
+func (inst *TerminalSetRule) desc() string {
+	if inst.name == "" {
+		return inst.setString()
+	}
+	return inst.name
+}
+
+func (inst *TerminalSetRule) matches(char rune) bool {
+	for _, item := range inst.items {
+		if item.matches(char) {
+			return !inst.negated
+		}
+	}
+	return inst.negated
+}
+
+func (inst *TerminalSetRule) Eval(grammar *Grammar, charstream ICharstream, flagLeadingSpaces int) *EvalResult {
+	return evalCharClass(inst, TypeSet, grammar, charstream, flagLeadingSpaces)
+}
+
+func (inst *TerminalSetRule) setString() string {
+	var buf strings.Builder
+	buf.WriteRune(EscapeSymbol)
+	buf.WriteRune(SetOpenSymbol)
+	if inst.negated {
+		buf.WriteRune(NegatedSymbol)
+	}
+	for _, item := range inst.items {
+		buf.WriteString(item.String())
+	}
+	buf.WriteRune(SetCloseSymbol)
+	return buf.String()
+}
+
+// Returns the rule definition string in xbnf format
+func (inst *TerminalSetRule) String() string {
+	return string(inst.annotation()) + inst.setString()
+}
+
+func (inst *TerminalSetRule) StringWithIndent(indent string) string {
+	return fmt.Sprintf("%s:%s", TypeSet, inst.String())
+}
+
+// inSet expects the 1st char in the input charstream is a '[', the leading '\' must already be
+// consumed. A '^' right after the '[' negates the set. Inside the set, a '\' escapes the next
+// char, unless it starts an unicode escape \u0041 or an unicode class \p{L}.
+func inSet(cs ICharstream) (*TerminalSetRule, error) {
+	rule := &TerminalSetRule{}
+	if cs.Next() != SetOpenSymbol {
+		return nil, fmt.Errorf("char set must start with '%c%c'", EscapeSymbol, SetOpenSymbol)
+	}
+	if cs.Peek() == NegatedSymbol {
+		cs.Next()
+		rule.negated = true
+	}
+	for {
+		char := cs.Peek()
+		if char == EOFChar {
+			return nil, fmt.Errorf("char set must end with '%c'", SetCloseSymbol)
+		}
+		if char == SetCloseSymbol {
+			cs.Next()
+			break
+		}
+		if char == EscapeSymbol {
+			cs.Next()
+			if next := cs.Peek(); next == ClassSymbol || next == NegatedClassSymbol {
+				class, err := inClass(cs)
+				if err != nil {
+					return nil, err
+				}
+				rule.items = append(rule.items, &setItem{class: class})
+				continue
+			}
+			cs.Seek(cs.Cursor() - 1)
+		}
+		begin, err := inSetChar(cs)
+		if err != nil {
+			return nil, err
+		}
+		item := &setItem{begin: begin, end: begin}
+		if cs.Peek() == CharRangeSymbol {
+			cs.Next()
+			if cs.Peek() == SetCloseSymbol { // a trailing '-' is a char
+				rule.items = append(rule.items, item, &setItem{begin: CharRangeSymbol, end: CharRangeSymbol})
+				continue
+			}
+			end, err := inSetChar(cs)
+			if err != nil {
+				return nil, err
+			}
+			if end < begin {
+				return nil, fmt.Errorf("char set: invalid range %s-%s", setCharString(begin), setCharString(end))
+			}
+			item.end = end
+		}
+		rule.items = append(rule.items, item)
+	}
+	if len(rule.items) == 0 {
+		return nil, fmt.Errorf("char set must contains at least 1 character")
+	}
+	return rule, nil
+}
+
+// inSetChar reads a char of a char set, which may be escaped
+func inSetChar(cs ICharstream) (rune, error) {
+	char := cs.Next()
+	if char != EscapeSymbol {
+		return char, nil
+	}
+	if cs.Peek() == 'u' {
+		return parseUnicodeEscape(cs)
+	}
+	char = cs.Next()
+	if char == EOFChar {
+		return 0, fmt.Errorf("char set must end with '%c'", SetCloseSymbol)
+	}
+	return char, nil
+}
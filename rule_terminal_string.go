@@ -7,23 +7,35 @@ import (
 
 type TerminalStringRule struct {
 	ruleBase
-	text []rune
+	text            []rune
+	caseInsensitive bool
 }
 
 func (inst *TerminalStringRule) desc() string {
 	if inst.name == "" {
-		return "\"" + string(inst.text) + "\""
+		return inst.literal()
 	}
 	return inst.name
 }
 
+func (inst *TerminalStringRule) literal() string {
+	if inst.caseInsensitive {
+		return string(CaseInsensitiveSymbol) + "\"" + string(inst.text) + "\""
+	}
+	return "\"" + string(inst.text) + "\""
+}
+
 func (inst *TerminalStringRule) Eval(grammar *Grammar, charstream ICharstream, flagLeadingSpaces int) *EvalResult {
+	start := charstream.Cursor()
 	evalResult := &EvalResult{
+		Start:  start,
+		End:    start,
 		Sticky: false,
 	}
 	if charstream.Peek() == EOFChar {
 		evalResult.Error = fmt.Errorf("missing %s at EOF", inst.desc())
 		evalResult.ErrIdx = charstream.Cursor()
+		grammar.expect(charstream, evalResult.ErrIdx, inst.desc())
 		return evalResult
 	}
 	node := &Node{
@@ -41,41 +53,24 @@ func (inst *TerminalStringRule) Eval(grammar *Grammar, charstream ICharstream, f
 	text := inst.text
 	if flagLeadingSpaces == SUGGEST_SKIP || flagLeadingSpaces == SUGGEST_NOT_SKIP {
 		leadingWSpaces := leadingWhiteSpace(text)
-		skippedWSpaces := charstream.SkipSpaces()
-		evalResult.CharsRead = append(evalResult.CharsRead, skippedWSpaces...)
-
-		if len(skippedWSpaces) < len(leadingWSpaces) {
-			// for sure not match
-			evalResult.CharsUnused = evalResult.CharsRead
-			evalResult.Error = fmt.Errorf("missing %s at %s", inst.desc(), startPos.String())
-			evalResult.ErrIdx = charstream.Cursor()
-			return evalResult
-		}
-		// now we need to check if the leadingWSpace matches the end of skippedWSpace
-		skippedWSpaces = skippedWSpaces[len(skippedWSpaces)-len(leadingWSpaces):]
-		for i, skippedWSpace := range skippedWSpaces {
-			if skippedWSpace != leadingWSpaces[i] {
-				// not match
-				evalResult.CharsUnused = evalResult.CharsRead
-				evalResult.Error = fmt.Errorf("missing %s at %s", inst.desc(), startPos.String())
-				evalResult.ErrIdx = charstream.Cursor()
-				return evalResult
-			}
-		}
-		// now the leadingWSpaces matched, check the rest of text
-		text = inst.text[len(leadingWSpaces):]
+		skippedWSpaces := grammar.skip(charstream)
+		// the leading white spaces of the text may be skipped already, the rest must follow
+		text = inst.text[skippedLeadingSpaces(skippedWSpaces, leadingWSpaces):]
 	}
 
-	charsRead, succeeded := charstream.Match(text)
-	evalResult.CharsRead = append(evalResult.CharsRead, charsRead...)
+	matchStart := charstream.Cursor()
+	matched, succeeded := matchText(charstream, text, inst.caseInsensitive || grammar.ignoreCase)
 	if !succeeded {
-		evalResult.CharsUnused = evalResult.CharsRead
 		evalResult.Error = fmt.Errorf("missing %s at %s", inst.desc(), startPos.String())
-		evalResult.ErrIdx = charstream.Cursor()
+		evalResult.ErrIdx = matchStart
+		grammar.expect(charstream, evalResult.ErrIdx, inst.desc())
+		charstream.Seek(start)
 		return evalResult
 	}
+	evalResult.End = charstream.Cursor()
 	node.Position = charstream.PositionLookup(charstream.Cursor() - len(inst.text))
-	node.Chars = append(node.Chars, inst.text...)
+	node.Chars = append(node.Chars, inst.text[:len(inst.text)-len(text)]...) // leading spaces
+	node.Chars = append(node.Chars, matched...)
 	evalResult.Node = node
 	return evalResult
 
@@ -83,8 +78,7 @@ func (inst *TerminalStringRule) Eval(grammar *Grammar, charstream ICharstream, f
 
 // Returns the rule definition string in xbnf format
 func (inst *TerminalStringRule) String() string {
-	str := string(inst.text)
-	return fmt.Sprintf("%s\"%s\"", string(inst.annotation()), str)
+	return string(inst.annotation()) + inst.literal()
 }
 
 func (inst *TerminalStringRule) StringWithIndent(indent string) string {
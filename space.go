@@ -1,44 +1,103 @@
 package xbnf
 
-type SpaceProperties struct{}
-
-var whiteSpaceMap = map[rune]*SpaceProperties{
-	'\u0009': nil, // TAB
-	'\u000A': nil, // LF - LineFeed
-	'\u000B': nil, // VT - Vertical Tab
-	'\u000C': nil, // FF - Form feed
-	'\u000D': nil, // CR - Carriage return
-	'\u0020': nil, // ' ' - space
-	'\u0085': nil, // NEL - Next line
-	'\u00A0': nil, //
-	'\u1680': nil,
-	'\u2000': nil,
-	'\u2001': nil,
-	'\u2002': nil,
-	'\u2003': nil,
-	'\u2004': nil,
-	'\u2005': nil,
-	'\u2006': nil,
-	'\u2007': nil,
-	'\u2008': nil,
-	'\u2009': nil,
-	'\u200A': nil,
-	'\u2028': nil,
-	'\u2029': nil,
-	'\u202F': nil,
-	'\u205F': nil,
-	'\u3000': nil,
+// IsWhiteSpace checks whether a char is an unicode white space. The white spaces are skipped
+// between tokens, unless the grammar has a skip rule, see Grammar.SetSkipRule.
+func IsWhiteSpace(char rune) bool {
+	switch char {
+	case '\u0009', // TAB
+		'\u000A', // LF - LineFeed
+		'\u000B', // VT - Vertical Tab
+		'\u000C', // FF - Form feed
+		'\u000D', // CR - Carriage return
+		'\u0020', // ' ' - space
+		'\u0085', // NEL - Next line
+		'\u00A0', // NBSP - No-break space
+		'\u1680',
+		'\u2000',
+		'\u2001',
+		'\u2002',
+		'\u2003',
+		'\u2004',
+		'\u2005',
+		'\u2006',
+		'\u2007',
+		'\u2008',
+		'\u2009',
+		'\u200A',
+		'\u2028',
+		'\u2029',
+		'\u202F',
+		'\u205F',
+		'\u3000':
+		return true
+	}
+	return false
 }
 
-var whiteSpaces []rune
+// skip skips the insignificant chars at the cursor, which are the white spaces by default, or the
+// matches of the skip rule of the grammar. It returns the white spaces skipped right before the
+// new cursor, which a terminal starting with white spaces may still match.
+func (inst *Grammar) skip(charstream ICharstream) []rune {
+	if inst.skipRule == "" {
+		return charstream.SkipSpaces()
+	}
+	record := inst.GetRecord(inst.skipRule)
+	if record == nil {
+		return charstream.SkipSpaces()
+	}
+	if inst.state == nil {
+		// the rule is evaluated directly rather than by one of the Eval methods of the grammar
+		defer inst.beginEval()()
+	}
+	state := inst.state
+	if state.skipping {
+		return nil // the terminals of the skip rule skip nothing
+	}
+	start := charstream.Cursor()
+	if last := state.skipped; last.charstream == charstream && last.start == start {
+		// skipped already, such as by the choice peeking at the next char, or by another alternative
+		charstream.Seek(last.end)
+		return last.spaces
+	}
+	state.skipping = true
+	inst.silence(true)
+	for charstream.Peek() != EOFChar {
+		cursor := charstream.Cursor()
+		result := inst.evalRecord(record, charstream, NOT_SKIP)
+		if result.Node == nil || result.End == cursor {
+			charstream.Seek(cursor)
+			break
+		}
+	}
+	inst.silence(false)
+	state.skipping = false
 
-func init() {
-	for key := range whiteSpaceMap {
-		whiteSpaces = append(whiteSpaces, key)
+	end := charstream.Cursor()
+	state.skipped = skipped{charstream: charstream, start: start, end: end}
+	if end == start {
+		return nil
+	}
+	chars := readChars(charstream, start, end)
+	i := len(chars)
+	for i > 0 && IsWhiteSpace(chars[i-1]) {
+		i--
 	}
+	state.skipped.spaces = chars[i:]
+	return state.skipped.spaces
 }
 
-func IsWhiteSpace(char rune) bool {
-	_, is := whiteSpaceMap[char]
-	return is
+// skippedLeadingSpaces returns how many of the leading white spaces of a text are at the end of
+// the skipped white spaces. The rest of the leading white spaces, if any, must be matched in the
+// input, as they are not insignificant to the skip rule.
+func skippedLeadingSpaces(skipped []rune, leading []rune) int {
+	n := len(leading)
+	if len(skipped) < n {
+		n = len(skipped)
+	}
+	for ; n > 0; n-- {
+		if string(skipped[len(skipped)-n:]) == string(leading[:n]) {
+			break
+		}
+	}
+	return n
 }
@@ -0,0 +1,143 @@
+package xbnf
+
+import (
+	"fmt"
+	"io"
+	"strings"
+)
+
+// TraceEvent describes an evaluation of a named rule, see Tracer
+type TraceEvent struct {
+	RuleName string
+	RuleType Type      // type of the rule defining the named rule
+	Cursor   int       // where the evaluation starts
+	Position *Position // position of the cursor, nil if unknown
+	Depth    int       // # of named rules in evaluation outside of this one
+
+	End   int   // where the match ends, set for Match
+	Error error // why the rule is not matched, set for Fail
+}
+
+// Tracer receives the events of the evaluations of named rules, see SetTracer. Each evaluation
+// calls Enter, then Match or Fail, then Exit. The events of the rules evaluated by the rule come
+// in between Enter and Match/Fail. Evaluations answered by the memo table are traced as well.
+type Tracer interface {
+	Enter(event *TraceEvent)
+	Match(event *TraceEvent)
+	Fail(event *TraceEvent)
+	Exit(event *TraceEvent)
+}
+
+// SetTracer sets the tracer of the evaluations of texts, nil turns tracing off. Evaluations of
+// a Parser are traced by the tracer of the grammar when it's compiled, the tracer must be safe
+// for concurrent use if the parser is used by many goroutines.
+func (inst *Grammar) SetTracer(tracer Tracer) {
+	inst.tracer = tracer
+}
+
+// traceRecord evaluates a named rule and sends the events of the evaluation to the tracer
+func (inst *Grammar) traceRecord(state *evalState, record *RuleRecord, charstream ICharstream, flagLeadingSpaces int) *EvalResult {
+	cursor := charstream.Cursor()
+	event := &TraceEvent{
+		RuleName: record.name,
+		RuleType: ruleType(record.rule),
+		Cursor:   cursor,
+		Position: positionAt(charstream, cursor),
+		Depth:    len(state.stack) - 1,
+	}
+	inst.tracer.Enter(event)
+	result := inst.evalStacked(state, record, charstream, flagLeadingSpaces)
+	if result.Node != nil {
+		event.End = result.End
+		inst.tracer.Match(event)
+	} else {
+		event.End = cursor
+		event.Error = result.Error
+		inst.tracer.Fail(event)
+	}
+	inst.tracer.Exit(event)
+	return result
+}
+
+// ruleType returns the type of the nodes a rule generates
+func ruleType(rule IRule) Type {
+	switch rule.(type) {
+	case *EOFRule:
+		return TypeEOF
+	case *TerminalCharRule:
+		return TypeChar
+	case *TerminalRangeRule:
+		return TypeRange
+	case *TerminalClassRule:
+		return TypeClass
+	case *TerminalSetRule:
+		return TypeSet
+	case *TerminalAnyRule:
+		return TypeAny
+	case *TerminalCharsRule:
+		return TypeChars
+	case *TerminalStringRule:
+		return TypeString
+	case *GroupRule:
+		return TypeGroup
+	case *OptionRule:
+		return TypeOption
+	case *BlockRule:
+		return TypeBlock
+	case *ReferenceRule:
+		return TypeReference
+	case *RepetitionRule:
+		return TypeRepetition
+	case *ChoiceRule:
+		return TypeChoice
+	case *ConcatenateRule:
+		return TypeConcatenate
+	case *PredicateRule:
+		return TypePredicate
+	case *DifferenceRule:
+		return TypeDifference
+	}
+	return ""
+}
+
+// TextTracer prints an indented trace of the evaluations, one line per event like:
+//
+//	> value (choice) at L1:1
+//	  > number (concatenate) at L1:1
+//	  < number matched 0-3
+//	< value matched 0-3
+//
+// The lines of the Exit events are not printed, it's always right after Match or Fail.
+type TextTracer struct {
+	writer io.Writer
+}
+
+// NewTextTracer creates a tracer printing the trace to the writer
+func NewTextTracer(writer io.Writer) *TextTracer {
+	return &TextTracer{writer: writer}
+}
+
+func (inst *TextTracer) Enter(event *TraceEvent) {
+	inst.printf(event, "> %s (%s) at %s", event.RuleName, event.RuleType, event.Position)
+}
+
+func (inst *TextTracer) Match(event *TraceEvent) {
+	inst.printf(event, "< %s matched %d-%d", event.RuleName, event.Cursor, event.End)
+}
+
+func (inst *TextTracer) Fail(event *TraceEvent) {
+	reason := "not matched"
+	if event.Error != nil {
+		// keep the 1st line only, the error may have the context of the input
+		reason = strings.SplitN(event.Error.Error(), "\n", 2)[0]
+	}
+	inst.printf(event, "< %s failed at %s: %s", event.RuleName, event.Position, reason)
+}
+
+func (inst *TextTracer) Exit(event *TraceEvent) {
+}
+
+func (inst *TextTracer) printf(event *TraceEvent, format string, args ...interface{}) {
+	indent := strings.Repeat("  ", event.Depth)
+	fmt.Fprintf(inst.writer, indent+format+"\n", args...)
+}
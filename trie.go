@@ -0,0 +1,161 @@
+package xbnf
+
+import "sort"
+
+// keywordTrie matches the literals of a choice in a single walk, for the choices made of string
+// literals only, or of chars literals only. The longest literal matched is the result of the
+// choice, the literals are not evaluated. The case-insensitive literals are kept in a separate
+// trie by their folded chars.
+type keywordTrie struct {
+	exact    *trieNode
+	folded   *trieNode
+	strings  bool          // the literals are strings, which skip the leading spaces unless NOT_SKIP
+	literals []trieLiteral // the literals by alternative
+}
+
+// trieLiteral is what the node of a literal is built from
+type trieLiteral struct {
+	rule     *ruleBase
+	ruleType Type
+	group    int // the order group of the literal in the choice
+}
+
+// trieMatch is a literal matched by the walk
+type trieMatch struct {
+	alt int
+	end int
+}
+
+type trieNode struct {
+	children map[rune]*trieNode
+	alts     []int // the alternatives ending at the node
+}
+
+func (inst *trieNode) add(text []rune, alt int) {
+	node := inst
+	for _, char := range text {
+		child := node.children[char]
+		if child == nil {
+			if node.children == nil {
+				node.children = make(map[rune]*trieNode)
+			}
+			child = &trieNode{}
+			node.children[char] = child
+		}
+		node = child
+	}
+	node.alts = append(node.alts, alt)
+}
+
+// newKeywordTrie builds the trie of the literals of a choice, nil if the choice has other rules,
+// or a literal starting with a white space, which may be skipped already.
+func newKeywordTrie(choice *ChoiceRule, ignoreCase bool) *keywordTrie {
+	trie := &keywordTrie{}
+	countStrings := 0
+	var alts []IRule
+	var groups []int
+	for group, rules := range choice.groups {
+		for _, rule := range rules {
+			alts = append(alts, rule)
+			groups = append(groups, group)
+		}
+	}
+	for i, alt := range alts {
+		var text []rune
+		var fold bool
+		literal := trieLiteral{group: groups[i]}
+		switch r := alt.(type) {
+		case *TerminalStringRule:
+			text, fold = r.text, r.caseInsensitive
+			literal.rule, literal.ruleType = &r.ruleBase, TypeString
+			countStrings++
+		case *TerminalCharsRule:
+			text, fold = r.text, r.caseInsensitive
+			literal.rule, literal.ruleType = &r.ruleBase, TypeChars
+		case *TerminalCharRule:
+			text, fold = []rune{r.text}, r.caseInsensitive
+			literal.rule, literal.ruleType = &r.ruleBase, TypeChar
+		default:
+			return nil
+		}
+		trie.literals = append(trie.literals, literal)
+		if len(text) == 0 || IsWhiteSpace(text[0]) {
+			return nil
+		}
+		if fold || ignoreCase {
+			if trie.folded == nil {
+				trie.folded = &trieNode{}
+			}
+			folded := make([]rune, len(text))
+			for j, char := range text {
+				folded[j] = foldKey(char)
+			}
+			trie.folded.add(folded, i)
+		} else {
+			if trie.exact == nil {
+				trie.exact = &trieNode{}
+			}
+			trie.exact.add(text, i)
+		}
+	}
+	if countStrings > 0 && countStrings < len(alts) {
+		return nil // strings and chars skip the leading spaces differently
+	}
+	trie.strings = countStrings > 0
+	return trie
+}
+
+// skips checks whether the literals skip the leading spaces
+func (inst *keywordTrie) skips(flagLeadingSpaces int) bool {
+	if inst.strings {
+		return flagLeadingSpaces != NOT_SKIP
+	}
+	return flagLeadingSpaces == SUGGEST_SKIP
+}
+
+// match returns the literals matching at the cursor by alternative, the cursor is moved
+func (inst *keywordTrie) match(charstream ICharstream) []trieMatch {
+	var matches []trieMatch
+	exact, folded := inst.exact, inst.folded
+	for exact != nil || folded != nil {
+		char := charstream.Next()
+		if char == EOFChar {
+			break
+		}
+		if exact != nil {
+			if exact = exact.children[char]; exact != nil {
+				for _, alt := range exact.alts {
+					matches = append(matches, trieMatch{alt: alt, end: charstream.Cursor()})
+				}
+			}
+		}
+		if folded != nil {
+			if folded = folded.children[foldKey(char)]; folded != nil {
+				for _, alt := range folded.alts {
+					matches = append(matches, trieMatch{alt: alt, end: charstream.Cursor()})
+				}
+			}
+		}
+	}
+	sort.Slice(matches, func(i, j int) bool { return matches[i].alt < matches[j].alt })
+	return matches
+}
+
+// longest returns the literal the choice matches: the longest match of the first order group
+// matched. It's false if nothing matches, or the longest matches are ambiguous.
+func (inst *keywordTrie) longest(matches []trieMatch) (trieMatch, bool) {
+	var found trieMatch
+	ambiguous := false
+	for i, match := range matches {
+		if i > 0 && inst.literals[match.alt].group != inst.literals[matches[0].alt].group {
+			break
+		}
+		switch {
+		case i == 0 || match.end > found.end:
+			found, ambiguous = match, false
+		case match.end == found.end:
+			ambiguous = true
+		}
+	}
+	return found, len(matches) > 0 && !ambiguous
+}
@@ -1,9 +1,16 @@
 package xbnf
 
 import (
+	"context"
+	"errors"
 	"fmt"
+	"os"
+	"path/filepath"
+	"sort"
 	"strings"
+	"sync"
 	"testing"
+	"time"
 )
 
 func init() {
@@ -21,8 +28,7 @@ func testRule(t *testing.T, grammar *Grammar, ruleName string, sample string, ex
 	t.Logf("====> RULE  : %s = %s", ruleName, rule.String())
 	cs := NewCharstreamFromString(sample)
 	result := rule.Eval(grammar, cs, SUGGEST_SKIP)
-	t.Logf("CharsRead:%s*", string(result.CharsRead))
-	t.Logf("CharsUnused:%s*", string(result.CharsUnused))
+	t.Logf("Start:%d, End:%d", result.Start, result.End)
 	if result.Node == nil {
 		if expected == "" {
 			t.Logf("====> Passed: %s", result.Error)
@@ -51,26 +57,26 @@ type Expected interface {
 }
 
 type ExpectedEvalResult struct {
-	CharsRead   string
-	CharsUnused string
-	Text        string
+	Start int
+	End   int
+	Text  string
 }
 
 func (inst *ExpectedEvalResult) StringTree() string {
 	var buf strings.Builder
 	buf.WriteString("Expected EvalResult")
-	buf.WriteString(fmt.Sprintf("\n├───CharsRead[%d]  :%s*", len(inst.CharsRead), inst.CharsRead))
-	buf.WriteString(fmt.Sprintf("\n├───CharsUnused[%d]:%s*", len(inst.CharsUnused), inst.CharsUnused))
+	buf.WriteString(fmt.Sprintf("\n├───Start:%d", inst.Start))
+	buf.WriteString(fmt.Sprintf("\n├───End  :%d", inst.End))
 	buf.WriteString(fmt.Sprintf("\n└───Text:%s*", inst.Text))
 	return buf.String()
 }
 
 func (inst *ExpectedEvalResult) Verdict(t *testing.T, actualResult *EvalResult) error {
-	if inst.CharsRead != string(actualResult.CharsRead) {
-		return fmt.Errorf("Unexpected CharsRead:%s*", string(actualResult.CharsRead))
+	if inst.Start != actualResult.Start {
+		return fmt.Errorf("Unexpected Start:%d", actualResult.Start)
 	}
-	if inst.CharsUnused != string(actualResult.CharsUnused) {
-		return fmt.Errorf("Unexpected CharsUnused:%s*", string(actualResult.CharsUnused))
+	if inst.End != actualResult.End {
+		return fmt.Errorf("Unexpected End:%d", actualResult.End)
 	}
 	if actualResult.Node == nil {
 		if inst.Text == "" {
@@ -277,7 +283,54 @@ func TestGrammarParseRule(t *testing.T) {
 			` "value" > <"" ( "," | ")" ) !> `,
 			`"value" > <"" ( "," | ")" ) !>`)
 	})
-
+	t.Run("predicate1", func(t *testing.T) {
+		tester(t, grammar, "predicate1", ` name  &'(' `, `name &'('`)
+	})
+	t.Run("predicate2", func(t *testing.T) {
+		tester(t, grammar, "predicate2", `!( "if" | "else" ) name`, `!( "if" | "else" ) name`)
+	})
+	t.Run("predicate3", func(t *testing.T) {
+		tester(t, grammar, "predicate3", `#!'a' | &~'b'`, `#!'a' | &~'b'`)
+	})
+	t.Run("predicate4", func(t *testing.T) {
+		tester(t, grammar, "predicate4", `'a' !`, "")
+	})
+	t.Run("difference1", func(t *testing.T) {
+		tester(t, grammar, "difference1", `name  --  ( "if" | "else" )`, `name -- ( "if" | "else" )`)
+	})
+	t.Run("difference2", func(t *testing.T) {
+		tester(t, grammar, "difference2", `'a'-'z' -- 'q' | 'A'`, `'a'-'z' -- 'q' | 'A'`)
+	})
+	t.Run("difference3", func(t *testing.T) {
+		tester(t, grammar, "difference3", `'a' 'b' #--'c'`, `'a' #('b' -- 'c')`)
+	})
+	t.Run("class1", func(t *testing.T) {
+		tester(t, grammar, "class1", ` \p{L} { \p{L} | \p{Nd} | '_' } `, `\p{L} { \p{L} | \p{Nd} | '_' }`)
+		tester(t, grammar, "class2", `\P{Greek}`, `\P{Greek}`)
+		tester(t, grammar, "class3", `\p{Foo}`, "")
+	})
+	t.Run("set1", func(t *testing.T) {
+		tester(t, grammar, "set1", `\[a-zA-Z_\p{Greek}]`, `\[a-zA-Z_\p{Greek}]`)
+		tester(t, grammar, "set2", `\[^"\\\u000A]`, `\[^"\\\u000A]`)
+		tester(t, grammar, "set3", `\[+-]`, `\[+\-]`)
+		tester(t, grammar, "set4", `\[\^\]]`, `\[\^\]]`)
+		tester(t, grammar, "set5", `\[]`, "")
+		tester(t, grammar, "set6", `\[z-a]`, "")
+		tester(t, grammar, "set7", `\[a-z`, "")
+	})
+	t.Run("any1", func(t *testing.T) {
+		tester(t, grammar, "any1", `'/*' { !'*/' . } '*/'`, `'/*' { !'*/' . } '*/'`)
+		tester(t, grammar, "any2", `< '"' ^\p{Cc} ^\[^ -~] '"' >`, `<'"' ^\p{Cc} ^\[^\u0020-~] '"'>`)
+	})
+	t.Run("ignorecase1", func(t *testing.T) {
+		tester(t, grammar, "ignorecase1", `i"select" i'ab'  i'x' #i"from"`, `i"select" i'ab' i'x' #i"from"`)
+		tester(t, grammar, "ignorecase2", `i'a'-'z'`, "")
+		tester(t, grammar, "ignorecase3", `i | j`, `i | j`)
+	})
+	t.Run("difference4", func(t *testing.T) {
+		tester(t, grammar, "difference4", `-- 'c'`, "")
+		tester(t, grammar, "difference5", `'a' - 'c'`, "")
+	})
 }
 
 func TestGrammarAddRule(t *testing.T) {
@@ -424,65 +477,1677 @@ func TestEvalRule(t *testing.T) {
 	t.Run("test24", func(t *testing.T) {
 		evalRule(t, ExpectedText("sean ivy kevin"), grammar, "names", " sean ivy kevin ")
 	})
-	t.Run("test25", func(t *testing.T) {
-		evalRule(t, ExpectedText("1"), grammar, "int", " 1 ")
+	t.Run("test25", func(t *testing.T) {
+		evalRule(t, ExpectedText("1"), grammar, "int", " 1 ")
+	})
+	t.Run("test26", func(t *testing.T) {
+		evalRule(t, ExpectedText("0xFF + 45 - 0b0101"), grammar, "expr", " 0xFF+45-0b0101")
+	})
+	t.Run("test27", func(t *testing.T) {
+		evalRule(t, ExpectedText("0xF45A"), grammar, "integer_hex", "0xF45A")
+	})
+	t.Run("test28", func(t *testing.T) {
+		evalRule(t, ExpectedText("0xF45A + 12345"), grammar, "expr", "0xF45A+12345.67")
+	})
+}
+
+func TestRange(t *testing.T) {
+	g, err := NewGrammarFromString(`
+		ctl = \u0001-\u0009
+	`)
+	if err != nil {
+		t.Errorf("Failed: %s", err)
+		return
+	}
+	t.Run("t1.skipped", func(t *testing.T) {
+		// the skipped spaces are checked against both bounds of the range
+		testRule(t, g, "ctl", " \tx", "\t")
+		testRule(t, g, "ctl", " x", "")
+	})
+}
+
+func TestGroup(t *testing.T) {
+	g, err := NewGrammarFromString(`
+		word = ( "ab" )
+	`)
+	if err != nil {
+		t.Errorf("Failed: %s", err)
+		return
+	}
+	t.Run("t1.position", func(t *testing.T) {
+		// the group node is located at its child node
+		result := g.GetRule("word").Eval(g, NewCharstreamFromString("\n  ab"), SUGGEST_SKIP)
+		if result.Node == nil || result.Node.RuleType != TypeGroup {
+			t.Errorf("Failed: expect a group node, got %v", result.Error)
+			return
+		}
+		if !result.Node.Position.is(2, 3) {
+			t.Errorf("Failed: expect position L2:3, got %s", result.Node.Position)
+			return
+		}
+		t.Logf("====> Passed")
+	})
+}
+
+func TestRepetition(t *testing.T) {
+	g, err := NewGrammarFromString(`
+		items = { [ "a" ] }
+	`)
+	if err != nil {
+		t.Errorf("Failed: %s", err)
+		return
+	}
+	t.Run("t1.emptyMatch", func(t *testing.T) {
+		// the item matches empty at "b", the repetition must stop there rather than loop forever
+		done := make(chan *EvalResult, 1)
+		go func() {
+			done <- g.GetRule("items").Eval(g, NewCharstreamFromString("aab"), SUGGEST_SKIP)
+		}()
+		select {
+		case result := <-done:
+			if result.Node == nil || result.End != 2 {
+				t.Errorf("Failed: expect a match of 2 chars, got %d: %v", result.End, result.Error)
+				return
+			}
+		case <-time.After(5 * time.Second):
+			t.Errorf("Failed: the repetition doesn't stop")
+			return
+		}
+		t.Logf("====> Passed")
+	})
+}
+
+func TestArithmeticRule(t *testing.T) {
+	grammar, err := NewGrammarFromString(`
+		SPACE   = \u0020  // space
+		TAB     = \u0009  // horizontal tab
+		NL      = \u000A  // new line
+		CR      = \u000D  // carriage return
+		space       = ~{ SPACE | TAB | NL | CR }
+		digit_dec   = '0' | '1' | '2' | '3' | '4' | '5' | '6' | '7' | '8' | '9'
+		digit_hex   = '0' | '1' | '2' | '3' | '4' | '5' | '6' | '7' | '8' | '9' | 'A' | 'B' | 'C' | 'D' | 'E' | 'F' | 'a' | 'b' | 'c' | 'd' | 'e' | 'f'
+		digit_oct   = '0' | '1' | '2' | '3' | '4' | '5' | '6' | '7'
+		digit_bin   = '0' | '1'
+		integer_dec = digit_dec { digit_dec } 
+		integer_hex = "0x" digit_hex { digit_hex }
+		integer_oct = "0o" digit_oct { digit_oct }
+		integer_bin = "0b" digit_bin { digit_bin }
+		float       = digit_dec '.' digit_dec { digit_dec }
+		integer     = integer_dec | integer_oct | integer_hex | integer_bin
+		literal		= integer | float
+		factor		= literal | ( "(" expr ")" )
+		term		= factor { ( "*" | "/" ) factor }
+		expr		= term { ("+" | "-") term }
+		exprs		= expr
+		// spaces		= { {space}+ "efg" }
+		spaces		= { { ~{'a'} }+ "efg" }
+	`)
+	if err != nil {
+		t.Errorf("Failed: %s", err)
+		return
+	}
+	t.Logf("\nGrammar:%s", grammar.Serialize(false))
+	evalRule(t, ExpectedText("12"), grammar, "term", "12")
+	evalRule(t, ExpectedText("12"), grammar, "term", " 12 ")
+	evalRule(t, ExpectedText("12 * 3"), grammar, "term", " 12 *    3 ")
+	evalRule(t, ExpectedText("1 / 12 * 12"), grammar, "term", "1/12*12")
+	evalRule(t, ExpectedText("12"), grammar, "expr", "12")
+	evalRule(t, ExpectedText("12 + 1"), grammar, "expr", "12 +   1")
+	evalRule(t, ExpectedText("12"), grammar, "literal", "12 +   1")
+	evalRule(t, ExpectedText("12 * 3 / 4"), grammar, "expr", "12*3/4")
+	evalRule(t, ExpectedText("2 - 12 / 4"), grammar, "expr", "2-12/4 ")
+	evalRule(t, ExpectedText("3 / 4 - 12 / 4"), grammar, "expr", " 3/4 -12/4 ")
+	evalRule(t, ExpectedText("( 4 + 5 )"), grammar, "expr", "(4 +5) ")
+	evalRule(t, ExpectedText("( 4 + 5 ) / 5"), grammar, "expr", " (4 +5) /5  ")
+	evalRule(t, ExpectedText("124 * 23 - 23 + 3 / 4 - 12 / 4"), grammar, "expr", "124*23 - 23 + 3/4 -12/4 ")
+	evalRule(t, ExpectedText("12 - 2 * 3"), grammar, "expr", " 12-2   *3  ")
+	evalRule(t, ExpectedText(""), grammar, "spaces", "")
+}
+
+func TestMemo(t *testing.T) {
+	grammar, err := NewGrammarFromString(`
+		digit       = '0'-'9'
+		integer     = digit { digit }
+		float       = integer '.' integer
+		literal     = integer | float
+		factor      = literal | ( "(" expr ")" ) | ( "(" expr ")" "!" )
+		term        = factor { ( "*" | "/" ) factor }
+		expr        = term { ("+" | "-") term }
+		exprs       = expr
+	`)
+	if err != nil {
+		t.Errorf("Failed: %s", err)
+		return
+	}
+	tester := func(t *testing.T, sample string, maxEntries int) {
+		t.Logf("====> SAMPLE: %s", sample)
+		grammar.DisableMemo()
+		expected, err := grammar.Eval(NewCharstreamFromString(sample), LevelBasic)
+		if err != nil {
+			t.Errorf("Failed: %s", err)
+			return
+		}
+		grammar.EnableMemo(maxEntries)
+		actual, err := grammar.Eval(NewCharstreamFromString(sample), LevelBasic)
+		if err != nil {
+			t.Errorf("Failed: %s", err)
+			return
+		}
+		stats := grammar.MemoStats()
+		t.Logf("Memo: %d hits, %d misses, %d evictions, hit rate %.2f", stats.Hits, stats.Misses, stats.Evictions, stats.HitRate())
+		if string(expected.Text()) != string(actual.Text()) {
+			t.Errorf("Failed: expected vs actual\n%s\n%s", string(expected.Text()), string(actual.Text()))
+			return
+		}
+		if stats.Hits == 0 {
+			t.Errorf("Failed: expect memo hits")
+			return
+		}
+		if maxEntries > 0 && stats.Evictions == 0 {
+			t.Errorf("Failed: expect memo evictions with max %d entries", maxEntries)
+			return
+		}
+		t.Logf("====> Passed: %s", string(actual.Text()))
+	}
+	t.Run("unbounded", func(t *testing.T) {
+		tester(t, "((1+2)*3)!-4/(5.5-6)", 0)
+	})
+	t.Run("nested", func(t *testing.T) {
+		tester(t, "((((((((1))))))))", 0)
+	})
+	t.Run("bounded", func(t *testing.T) {
+		tester(t, "((1+2)*3)!-4/(5.5-6)", 4)
+	})
+	grammar.DisableMemo()
+	t.Run("silenced", func(t *testing.T) {
+		// digit fails in the negative predicate first, the failure must still be reported when
+		// it fails again in the 2nd alternative
+		g, err := NewGrammarFromString(`
+			@start stmt
+			stmt  = ( !digit "x" ) | ( digit ";" )
+			digit = '0'-'9'
+		`)
+		if err != nil {
+			t.Errorf("Failed: %s", err)
+			return
+		}
+		_, expected := g.Eval(NewCharstreamFromString("a"), LevelBasic)
+		g.EnableMemo(0)
+		_, actual := g.Eval(NewCharstreamFromString("a"), LevelBasic)
+		if expected == nil || actual == nil || expected.Error() != actual.Error() {
+			t.Errorf("Failed: expected vs actual\n%v\n%v", expected, actual)
+			return
+		}
+		t.Logf("====> Passed: %s", actual)
+	})
+}
+
+func TestLeftRecursion(t *testing.T) {
+	// bracket puts every expr node in brackets, so the shape of the tree is visible in text
+	var bracket func(node *Node) string
+	bracket = func(node *Node) string {
+		if len(node.ChildNodes) == 0 {
+			return string(node.Chars)
+		}
+		var buf strings.Builder
+		for _, child := range node.ChildNodes {
+			buf.WriteString(bracket(child))
+		}
+		if node.RuleName == "expr" {
+			return "(" + buf.String() + ")"
+		}
+		return buf.String()
+	}
+	tester := func(t *testing.T, grammar *Grammar, sample string, expected string) {
+		t.Logf("====> SAMPLE: %s", sample)
+		for _, memo := range []bool{false, true} {
+			if memo {
+				grammar.EnableMemo(0)
+			} else {
+				grammar.DisableMemo()
+			}
+			ast, err := grammar.Eval(NewCharstreamFromString(sample), LevelBasic)
+			if err != nil {
+				t.Errorf("Failed: memo %t: %s", memo, err)
+				return
+			}
+			actual := bracket(ast.Nodes[0])
+			if actual != expected {
+				t.Errorf("Failed: memo %t: expected vs actual\n%s\n%s", memo, expected, actual)
+				return
+			}
+		}
+		grammar.DisableMemo()
+		t.Logf("====> Passed: %s", expected)
+	}
+	direct, err := NewGrammarFromString(`
+		term  = '0'-'9'
+		expr  = ( expr ("+" | "-") term ) | term
+		exprs = expr
+	`)
+	if err != nil {
+		t.Errorf("Failed: %s", err)
+		return
+	}
+	indirect, err := NewGrammarFromString(`
+		num   = '0'-'9'
+		sum   = expr "+" num
+		expr  = sum | num
+		exprs = expr
+	`)
+	if err != nil {
+		t.Errorf("Failed: %s", err)
+		return
+	}
+	t.Run("direct", func(t *testing.T) {
+		tester(t, direct, "1+2-3", "(((1)+2)-3)")
+	})
+	t.Run("direct.single", func(t *testing.T) {
+		tester(t, direct, "1", "(1)")
+	})
+	t.Run("indirect", func(t *testing.T) {
+		tester(t, indirect, "1 + 2 + 3", "(((1)+2)+3)")
+	})
+	t.Run("disabled", func(t *testing.T) {
+		grammar, err := NewGrammarFromString(`
+			term  = '0'-'9'
+			expr  = ( expr "+" term ) | term
+			exprs = expr
+		`)
+		if err != nil {
+			t.Errorf("Failed: %s", err)
+			return
+		}
+		grammar.SetLeftRecursion(false)
+		err = grammar.Validate()
+		if err == nil || !strings.Contains(err.Error(), "expr -> expr") {
+			t.Errorf("Failed: expect left recursion error, got %v", err)
+			return
+		}
+		t.Logf("Validate: %s", err)
+		_, err = grammar.Eval(NewCharstreamFromString("1+2"), LevelBasic)
+		if err == nil {
+			t.Errorf("Failed: expect eval error")
+			return
+		}
+		t.Logf("====> Passed: %s", err)
+	})
+}
+
+func TestPredicate(t *testing.T) {
+	g, err := NewGrammarFromString(`
+		keyword = "if" | "else"
+		letter  = 'a'-'z'
+		ident   = !( keyword !letter ) letter { letter }
+		call    = ident &'(' "()"
+	`)
+	if err != nil {
+		t.Errorf("Failed: %s", err)
+		return
+	}
+	t.Run("t1.ident", func(t *testing.T) {
+		testRule(t, g, "ident", `abc`, "abc")
+		testRule(t, g, "ident", `iffy`, "iffy")
+		testRule(t, g, "ident", `if`, "")
+		testRule(t, g, "ident", `else `, "")
+	})
+	t.Run("t2.call", func(t *testing.T) {
+		testRule(t, g, "call", `abc()`, "abc ()")
+		testRule(t, g, "call", `abc ()`, "") // chars are sticky, so is the lookahead of chars
+		testRule(t, g, "call", `abc`, "")
+	})
+	t.Run("t3.parseError", func(t *testing.T) {
+		result := g.EvalRule("ident", "else")
+		parseErr, ok := result.Error.(*ParseError)
+		if !ok || strings.Join(parseErr.Expected, " ") != "not keyword and not letter" {
+			t.Errorf("Failed: unexpected error %v", result.Error)
+			return
+		}
+		t.Logf("====> Passed: %s", parseErr)
+	})
+	t.Run("t4.block", func(t *testing.T) {
+		// '!' is the virtual close in a block, a negative lookahead must be in a group
+		for _, rule := range []string{`b = < !"a" "c" >`, `b = < "a" !"b" "c" >`, `b = < "a" ^"x" !"b" >`} {
+			_, err := NewGrammarFromString(rule)
+			if err == nil || !strings.Contains(err.Error(), "put a '!' predicate in a group") {
+				t.Errorf("Failed: %s - expect a predicate error, got %v", rule, err)
+				return
+			}
+		}
+		g, err := NewGrammarFromString(`b = < "a" ( !"b" . ) "c" ! >`)
+		if err != nil {
+			t.Errorf("Failed: %s", err)
+			return
+		}
+		if actual := g.GetRule("b").String(); actual != `<"a" ( !"b" . ) "c" !>` {
+			t.Errorf("Failed: unexpected rule %s", actual)
+			return
+		}
+		t.Logf("====> Passed")
+	})
+	t.Run("t5.readme", func(t *testing.T) {
+		// the examples of the README
+		g, err := NewGrammarFromString(`
+			name    = 'a'-'z' { 'a'-'z' }
+			ident   = name !'('
+			comment = < ( "/*" !'*' ) "*/" >
+		`)
+		if err != nil {
+			t.Errorf("Failed: %s", err)
+			return
+		}
+		testRule(t, g, "ident", `abc`, "abc")
+		testRule(t, g, "ident", `abc(`, "")
+		testRule(t, g, "comment", `/* a */`, "/* a */")
+		testRule(t, g, "comment", `/** a */`, "")
+	})
+}
+
+func TestDifference(t *testing.T) {
+	g, err := NewGrammarFromString(`
+		keyword = "if" | "else"
+		letter  = 'a'-'z'
+		word    = letter { letter }
+		ident   = word -- keyword
+		char    = \u0020-\u007E -- '"'
+		string  = '"' { char } '"'
+	`)
+	if err != nil {
+		t.Errorf("Failed: %s", err)
+		return
+	}
+	t.Run("t1.ident", func(t *testing.T) {
+		testRule(t, g, "ident", `abc`, "abc")
+		testRule(t, g, "ident", `iffy`, "iffy")
+		testRule(t, g, "ident", `if`, "")
+		testRule(t, g, "ident", `else`, "")
+	})
+	t.Run("t2.string", func(t *testing.T) {
+		testRule(t, g, "string", `"abc def"`, `"abc def"`)
+		testRule(t, g, "string", `"abc"def"`, `"abc"`)
+		testRule(t, g, "char", `"`, "")
+	})
+	t.Run("t3.parseError", func(t *testing.T) {
+		result := g.EvalRule("ident", "else")
+		parseErr, ok := result.Error.(*ParseError)
+		if !ok || strings.Join(parseErr.Expected, " ") != "ident" || !parseErr.Position.is(1, 1) {
+			t.Errorf("Failed: unexpected error %v", result.Error)
+			return
+		}
+		t.Logf("====> Passed: %s", parseErr)
+	})
+	t.Run("t4.precedence", func(t *testing.T) {
+		// "--" binds tighter than a choice in either order of the operands
+		g, err := NewGrammarFromString(`
+			a     = 'y'
+			b     = 'z'
+			c     = 'y'
+			left  = a | b -- c
+			right = b -- c | a
+		`)
+		if err != nil {
+			t.Errorf("Failed: %s", err)
+			return
+		}
+		for name, expected := range map[string]string{"left": "a | b -- c", "right": "b -- c | a"} {
+			if rule := g.GetRecord(name).rule.String(); rule != expected {
+				t.Errorf("Failed: expect rule %s be %s, got %s", name, expected, rule)
+				return
+			}
+			if _, ok := g.GetRecord(name).rule.(*ChoiceRule); !ok {
+				t.Errorf("Failed: expect rule %s be a choice", name)
+				return
+			}
+		}
+		testRule(t, g, "left", `y`, "y")
+		testRule(t, g, "left", `z`, "z")
+		testRule(t, g, "right", `y`, "y")
+		testRule(t, g, "right", `z`, "z")
+	})
+}
+
+func TestCharClass(t *testing.T) {
+	g, err := NewGrammarFromString(`
+		ident   = \p{L} { \p{L} | \p{Nd} | '_' }
+		greek   = \p{Greek} { \p{Greek} }
+		hex     = '0x' \[0-9a-fA-F] { \[0-9a-fA-F] }
+		line    = \[^\u000A] { \[^\u000A] }
+		nonword = \P{L}
+		comment = '/*' { !'*/' . } '*/'
+		string  = < '"' ^\p{Cc} '"' >
+		ascii   = < '"' ^\[^ -~] '"' >
+	`)
+	if err != nil {
+		t.Errorf("Failed: %s", err)
+		return
+	}
+	t.Run("t1.class", func(t *testing.T) {
+		testRule(t, g, "ident", `Größe_2`, "Größe_2")
+		testRule(t, g, "ident", `名字`, "名字")
+		testRule(t, g, "ident", `_x`, "")
+		testRule(t, g, "ident", `2x`, "")
+		testRule(t, g, "greek", `αβγ`, "αβγ")
+		testRule(t, g, "greek", `abc`, "")
+		testRule(t, g, "nonword", `+`, "+")
+		testRule(t, g, "nonword", `a`, "")
+	})
+	t.Run("t2.set", func(t *testing.T) {
+		testRule(t, g, "hex", `0x1aF`, "0x1aF")
+		testRule(t, g, "hex", `0xg`, "")
+		testRule(t, g, "line", "abc def\nxyz", "abc def")
+	})
+	t.Run("t3.any", func(t *testing.T) {
+		testRule(t, g, "comment", "/* a * b\n */", "/* a * b\n */")
+		testRule(t, g, "comment", "/* a", "")
+	})
+	t.Run("t4.block", func(t *testing.T) {
+		testRule(t, g, "string", `"abc"`, `"abc"`)
+		testRule(t, g, "string", "\"ab\tc\"", "")
+		testRule(t, g, "ascii", `"a b"`, `"a b"`)
+		testRule(t, g, "ascii", `"é"`, "")
+	})
+	t.Run("t5.nodeType", func(t *testing.T) {
+		// the node of a terminal is of the type of the rule, as reported to the tracer
+		g, err := NewGrammarFromString(`
+			class = \p{L}
+			set   = \[a-z]
+			any   = .
+			range = 'a'-'z'
+		`)
+		if err != nil {
+			t.Errorf("Failed: %s", err)
+			return
+		}
+		expected := map[string]Type{"class": TypeClass, "set": TypeSet, "any": TypeAny, "range": TypeRange}
+		for name, expectedType := range expected {
+			rule := g.GetRule(name)
+			result := rule.Eval(g, NewCharstreamFromString("x"), NOT_SKIP)
+			if result.Node == nil || result.Node.RuleType != expectedType || ruleType(rule) != expectedType {
+				t.Errorf("Failed: %s - expect node type %s, got %v", name, expectedType, result.Node)
+				return
+			}
+		}
+		t.Logf("====> Passed")
+	})
+}
+
+func TestIgnoreCase(t *testing.T) {
+	grammarText := `
+		letter = 'a'-'z' | 'A'-'Z'
+		name   = letter { letter }
+		select = "select" name "from" name
+		where  = i"where" 'x' '=' i'y'
+		stmt   = select [ where ]
+	`
+	g, err := NewGrammarFromString(strings.Replace(grammarText, `"select" name "from"`, `i"select" name i"from"`, 1))
+	if err != nil {
+		t.Errorf("Failed: %s", err)
+		return
+	}
+	t.Run("t1.literal", func(t *testing.T) {
+		testRule(t, g, "select", `SeLeCt a FROM b`, "SeLeCt a FROM b")
+		testRule(t, g, "where", `WHERE x=Y`, "WHERE x=Y")
+		testRule(t, g, "where", `where X=y`, "")
+		testRule(t, g, "select", `selec a from b`, "")
+	})
+	t.Run("t2.directive", func(t *testing.T) {
+		g, err := NewGrammarFromString("@ignorecase\n" + grammarText)
+		if err != nil {
+			t.Errorf("Failed: %s", err)
+			return
+		}
+		testRule(t, g, "select", `SELECT a From b`, "SELECT a From b")
+		testRule(t, g, "where", `Where X=y`, "Where X=y")
+		g.SetIgnoreCase(false)
+		testRule(t, g, "select", `SELECT a From b`, "")
+	})
+	t.Run("t3.fold", func(t *testing.T) {
+		g, err := NewGrammarFromString(`word = i"straße" | i"σοφία"`)
+		if err != nil {
+			t.Errorf("Failed: %s", err)
+			return
+		}
+		testRule(t, g, "word", `STRAẞE`, "STRAẞE")
+		testRule(t, g, "word", `ΣΟΦΊΑ`, "ΣΟΦΊΑ")
+		testRule(t, g, "word", `STRASSE`, "") // multi-char folds are not supported
+	})
+	t.Run("t4.ruleNamedI", func(t *testing.T) {
+		// i"x" is ambiguous with a reference to the rule i followed by "x"
+		_, err := NewGrammarFromString(`
+			i    = "in"
+			loop = "for" i"x"
+		`)
+		if err == nil || !strings.Contains(err.Error(), `literal i"x" of rule 'loop' at line 3 is ambiguous with the rule 'i'`) {
+			t.Errorf("Failed: expect an ambiguous prefix error, got %v", err)
+			return
+		}
+		g, err := NewGrammarFromString(`
+			i    = "in"
+			loop = "for" i "x"
+		`)
+		if err != nil {
+			t.Errorf("Failed: %s", err)
+			return
+		}
+		testRule(t, g, "loop", `for in x`, "for in x")
+		t.Logf("====> Passed")
+	})
+}
+
+func TestSkipRule(t *testing.T) {
+	rules := `
+		name   = \[a-z] { \[a-z] }
+		assign = name "=" name "\u000A"
+		assigns = assign { assign }
+	`
+	g1, err := NewGrammarFromString(`
+		@skip ws
+		ws = \[ \u0009] | ( '/*' { !'*/' . } '*/' ) | ( '//' { \[^\u000A] } )
+	` + rules)
+	if err != nil {
+		t.Errorf("Failed: %s", err)
+		return
+	}
+	g2, err := NewGrammarFromString(rules)
+	if err != nil {
+		t.Errorf("Failed: %s", err)
+		return
+	}
+	t.Run("t1.comment", func(t *testing.T) {
+		testRule(t, g1, "assign", "a /* x */ = /* y */b // z\n", "a = b\n")
+		testRule(t, g1, "assigns", "a=b\n/* x\n y */ c = d // z\n", "a = b\nc = d\n")
+		testRule(t, g2, "assign", "a /* x */ = b\n", "")
+	})
+	t.Run("t2.newline", func(t *testing.T) {
+		testRule(t, g1, "assign", "a =\n b\n", "")
+		testRule(t, g2, "assign", "a =\n b\n", "a = b\n")
+	})
+	t.Run("t3.eval", func(t *testing.T) {
+		ast, err := g1.Eval(NewCharstreamFromString("a = b // z\n c = d\n  /* end */ "), 1)
+		if err != nil {
+			t.Errorf("Failed: %s", err)
+			return
+		}
+		if ast == nil || len(ast.Nodes) != 1 {
+			t.Errorf("Failed: expect 1 node")
+			return
+		}
+		t.Logf("====> Passed: %s", string(ast.Nodes[0].Text()))
+	})
+	t.Run("t4.setskiprule", func(t *testing.T) {
+		if err := g1.Validate(); err != nil {
+			t.Errorf("Failed: %s", err)
+			return
+		}
+		if g1.GetRecord("ws") == nil || g1.rootRules["ws"] != nil {
+			t.Errorf("Failed: skip rule must not be a root rule")
+			return
+		}
+		g2.SetSkipRule("undefined")
+		if err := g2.Validate(); err == nil {
+			t.Errorf("Failed: expect error for undefined skip rule")
+			return
+		}
+		g2.SetSkipRule("")
+		t.Logf("====> Passed")
+	})
+	t.Run("t5.char", func(t *testing.T) {
+		g, err := NewGrammarFromString(`
+			@skip sp
+			sp   = ' ' | \u0009
+			line = "key" \u000A
+		`)
+		if err != nil {
+			t.Errorf("Failed: %s", err)
+			return
+		}
+		testRule(t, g, "line", "key\n", "key\n")
+		testRule(t, g, "line", "key \t\n", "key\n")
+		testRule(t, g, "line", "key x\n", "")
+	})
+}
+
+func TestMultiLine(t *testing.T) {
+	g, err := NewGrammarFromString(`
+		// a json value on multiple lines
+		value = "null"
+			| "true" // the literals
+			| "false"
+
+			// the compounds
+			| array
+		array = #"["
+			[ value { #"," value } ]
+			#"]"
+		@start value
+		string = < '"'
+			'\\' '"' >
+	`)
+	if err != nil {
+		t.Errorf("Failed: %s", err)
+		return
+	}
+	t.Logf("\nGrammar:%s", g.Serialize(false))
+	t.Run("t1.eval", func(t *testing.T) {
+		testRule(t, g, "value", `[ true, [null], false ]`, "[ true , [ null ] , false ]")
+		testRule(t, g, "string", `"a \" b"`, `"a " b"`)
+	})
+	t.Run("t2.line", func(t *testing.T) {
+		for name, line := range map[string]int{"value": 3, "array": 9, "string": 13} {
+			if record := g.GetRecord(name); record == nil || record.line != line {
+				t.Errorf("Failed: rule %s is expected at line %d", name, line)
+				return
+			}
+		}
+		t.Logf("====> Passed")
+	})
+	t.Run("t3.error", func(t *testing.T) {
+		_, err := NewGrammarFromString("a = 'a'\n\nb = 'b'\n  | 'c'\n  | )\nc = 'c'")
+		if err == nil || !strings.HasPrefix(err.Error(), "L#3: rule [b]") {
+			t.Errorf("Failed: expect error at L#3, got %v", err)
+			return
+		}
+		t.Logf("====> Passed: %s", err)
+	})
+	t.Run("t4.oneLine", func(t *testing.T) {
+		// the multi-line rule of the README is the same as its one-line form
+		rules := "string = '\"' { 'a'-'z' } '\"'\nnumber = '0'-'9' { '0'-'9' }\nobject = \"{\" \"}\"\narray = \"[\" \"]\"\n"
+		multi, err := NewGrammarFromString(rules + `
+			value = string | number | object | array
+			      | "true" | "false" // the literals
+			      | "null"
+		`)
+		if err != nil {
+			t.Errorf("Failed: %s", err)
+			return
+		}
+		single, err := NewGrammarFromString(rules + `value = string | number | object | array | "true" | "false" | "null"`)
+		if err != nil {
+			t.Errorf("Failed: %s", err)
+			return
+		}
+		if multi.GetRecord("value").rule.String() != single.GetRecord("value").rule.String() {
+			t.Errorf("Failed: expected vs actual rule\n%s\n%s", single.GetRecord("value").rule, multi.GetRecord("value").rule)
+			return
+		}
+		for _, sample := range []string{`"abc"`, `12`, `{ }`, `false`, `null`} {
+			expected, err := single.EvalFrom("value", NewCharstreamFromString(sample), LevelRaw)
+			if err != nil {
+				t.Errorf("Failed: %s", err)
+				return
+			}
+			actual, err := multi.EvalFrom("value", NewCharstreamFromString(sample), LevelRaw)
+			if err != nil {
+				t.Errorf("Failed: %s", err)
+				return
+			}
+			if actual.StringTree(nil) != expected.StringTree(nil) {
+				t.Errorf("Failed: expected vs actual AST\n%s\n%s", expected.StringTree(nil), actual.StringTree(nil))
+				return
+			}
+		}
+		t.Logf("====> Passed")
+	})
+}
+
+func TestImport(t *testing.T) {
+	dir := t.TempDir()
+	files := map[string]string{
+		"common/number.xbnf": "digit   = '0'-'9'\ninteger = [ '-' ] digit { digit }\n@start integer // ignored\n",
+		"common/string.xbnf": "@import number.xbnf\nstring = < '\"' '\\\\' '\"' >\n",
+		"main.xbnf":          "@import common/string.xbnf as common\n\npair = common.string \":\" common.integer\n",
+		"cycle1.xbnf":        "@import cycle2.xbnf\na = 'a'\n",
+		"cycle2.xbnf":        "@import cycle1.xbnf as c\nb = 'b'\n",
+		"error.xbnf":         "@import common/bad.xbnf as x\nc = x.a\n",
+		"common/bad.xbnf":    "a = 'a'\n\nb = 'b' |\n",
+	}
+	for name, text := range files {
+		path := filepath.Join(dir, name)
+		if err := os.MkdirAll(filepath.Dir(path), 0755); err != nil {
+			t.Fatal(err)
+		}
+		if err := os.WriteFile(path, []byte(text), 0644); err != nil {
+			t.Fatal(err)
+		}
+	}
+	t.Run("t1.namespace", func(t *testing.T) {
+		g, err := NewGrammarFromFile(filepath.Join(dir, "main.xbnf"))
+		if err != nil {
+			t.Errorf("Failed: %s", err)
+			return
+		}
+		t.Logf("\nGrammar:%s", g.Serialize(false))
+		testRule(t, g, "pair", `"a:b" : -12`, `"a:b" : -12`)
+		record := g.GetRecord("common.digit")
+		if record == nil || record.file != filepath.Join(dir, "common/number.xbnf") || record.line != 1 {
+			t.Errorf("Failed: expect common.digit at line 1 of common/number.xbnf")
+			return
+		}
+		if len(g.rootRules) != 1 || g.rootRules["pair"] == nil || g.startRule != "" {
+			t.Errorf("Failed: imported rules must not be root rules, nor their directives applied")
+			return
+		}
+		t.Logf("====> Passed")
+	})
+	t.Run("t2.cycle", func(t *testing.T) {
+		_, err := NewGrammarFromFile(filepath.Join(dir, "cycle1.xbnf"))
+		if err == nil || !strings.Contains(err.Error(), "import cycle") {
+			t.Errorf("Failed: expect import cycle, got %v", err)
+			return
+		}
+		t.Logf("====> Passed: %s", err)
+	})
+	t.Run("t3.error", func(t *testing.T) {
+		_, err := NewGrammarFromFile(filepath.Join(dir, "error.xbnf"))
+		if err == nil || !strings.Contains(err.Error(), filepath.Join(dir, "common/bad.xbnf")+": L#3: rule [b]") {
+			t.Errorf("Failed: expect error at L#3 of common/bad.xbnf, got %v", err)
+			return
+		}
+		t.Logf("====> Passed: %s", err)
+		g := NewGrammar()
+		g.AddRule("a = 'a'")
+		_, err = g.AddRule("c = x.b")
+		if err != nil {
+			t.Errorf("Failed: %s", err)
+			return
+		}
+		err = g.Validate()
+		if err == nil || !strings.Contains(err.Error(), "used by rule 'c' at line 2") {
+			t.Errorf("Failed: expect the rule referencing x.b, got %v", err)
+			return
+		}
+		t.Logf("====> Passed: %s", err)
+	})
+}
+
+func TestLint(t *testing.T) {
+	g, err := NewGrammarFromString(`
+		@start doc
+		doc     = { item | twice | quoted }
+		item    = word | ( "a" > "ab" | "c" | "c" )
+		word    = { [ letter ] }
+		letter  = 'a'-'z'
+		twice   = { letter }<0,0>
+		quoted  = < '"' ^'"' '"' >
+		orphan1 = 'x' orphan2
+		orphan2 = 'y' [ orphan1 ]
+	`)
+	if err != nil {
+		t.Errorf("Failed: %s", err)
+		return
+	}
+	issues, err := g.Lint()
+	if err != nil {
+		t.Errorf("Failed: %s", err)
+		return
+	}
+	expected := []string{
+		"L#3: rule [doc] - alternatives item and twice are ambiguous, both match \"\"",
+		"L#3: rule [doc] - repetition of item | twice | quoted can match empty",
+		"L#4: rule [item] - alternative \"ab\" is shadowed by \"a\" in an earlier group",
+		"L#4: rule [item] - alternatives word and ( \"a\" > \"ab\" | \"c\" | \"c\" ) are ambiguous, both match \"a\"",
+		"L#4: rule [item] - duplicate alternative \"c\"",
+		"L#5: rule [word] - repetition of [ letter ] can match empty",
+		"L#7: rule [twice] - repetition spec <0,0> means 0 or more times, use { } instead",
+		"L#8: rule [quoted] - block close '\"' can never match, it's excluded by '\"'",
+		"L#9: rule [orphan1] - unreachable from the start rule doc",
+		"L#10: rule [orphan2] - unreachable from the start rule doc",
+	}
+	var actual []string
+	for _, issue := range issues {
+		actual = append(actual, issue.String())
+	}
+	if strings.Join(actual, "\n") != strings.Join(expected, "\n") {
+		t.Errorf("Failed: expected vs actual\n%s\n\n%s", strings.Join(expected, "\n"), strings.Join(actual, "\n"))
+		return
+	}
+	t.Logf("====> Passed:\n%s", strings.Join(actual, "\n"))
+}
+
+func TestAnalysis(t *testing.T) {
+	g, err := NewGrammarFromString(`
+		@start value
+		value   = object | array | "true" | "false" | "null" | number | string
+		object  = "{" [ pair { "," pair } ] "}"
+		pair    = string ":" value
+		array   = "[" [ value { "," value } ] "]"
+		number  = [ '-' ] digit { digit }
+		digit   = '0'-'9'
+		string  = < '"' '\\' '"' >
+		tail    = { 'x' }<0,3> EOF
+		keyword = i"select" \p{Lu} \[^a-z]
+	`)
+	if err != nil {
+		t.Errorf("Failed: %s", err)
+		return
+	}
+	tester := func(t *testing.T, analysis *Analysis, name string, nullable bool, first string, follow string) {
+		if analysis.Nullable(name) != nullable {
+			t.Errorf("Failed: %s nullable expected %v", name, nullable)
+			return
+		}
+		if analysis.First(name).String() != first {
+			t.Errorf("Failed: FIRST(%s) expected vs actual\n%s\n%s", name, first, analysis.First(name))
+			return
+		}
+		if analysis.Follow(name).String() != follow {
+			t.Errorf("Failed: FOLLOW(%s) expected vs actual\n%s\n%s", name, follow, analysis.Follow(name))
+			return
+		}
+		t.Logf("====> Passed: %s FIRST %s FOLLOW %s", name, first, follow)
+	}
+	t.Run("t1.sets", func(t *testing.T) {
+		analysis := g.Analysis()
+		tester(t, analysis, "value", false, `\["\-0-9[fnt{] "\"" "-" "[" "false" "null" "true" "{"`, `\[,\]}] "," "]" "}" EOF`)
+		tester(t, analysis, "pair", false, `\["] "\""`, `\[,}] "," "}"`)
+		tester(t, analysis, "digit", false, `\[0-9]`, `\[,0-9\]}] "," "]" "}" EOF`)
+		tester(t, analysis, "string", false, `\["] "\""`, `\[,:\]}] "," ":" "]" "}" EOF`)
+		tester(t, analysis, "tail", true, `\[x] "x" EOF`, ``)
+		tester(t, analysis, "keyword", false, `\[Ssſ] "select"`, ``)
+		if !analysis.First("keyword").Contains('S') || analysis.First("value").Contains('x') {
+			t.Errorf("Failed: unexpected Contains result")
+		}
+	})
+	t.Run("t2.cache", func(t *testing.T) {
+		analysis := g.Analysis()
+		if g.Analysis() != analysis {
+			t.Errorf("Failed: analysis is not cached")
+			return
+		}
+		g.AddRule("extra = 'y' value")
+		if g.Analysis() == analysis || g.Analysis().First("extra").String() != `\[y] "y"` {
+			t.Errorf("Failed: analysis is not invalidated by AddRule")
+			return
+		}
+		t.Logf("====> Passed")
+	})
+}
+
+func TestAmbiguity(t *testing.T) {
+	g, err := NewGrammarFromString(`
+		stmt    = assign | call | number | keyword | ordered
+		assign  = name "=" name
+		call    = name "(" ")"
+		name    = letter { letter }
+		letter  = 'a'-'z'
+		number  = integer | float | digits
+		integer = digit { digit }
+		digits  = digit { digit }
+		float   = digit "." digit
+		digit   = '0'-'9'
+		keyword = "if" | i"IF"
+		ordered = "else" > "else"
+	`)
+	if err != nil {
+		t.Errorf("Failed: %s", err)
+		return
+	}
+	g.EnableMemo(0)
+	profiler := NewProfiler()
+	g.SetProfiler(profiler)
+	ambiguities, err := g.Ambiguities()
+	if err != nil {
+		t.Errorf("Failed: %s", err)
+		return
+	}
+	// the sample texts are evaluated on a copy of the grammar
+	if stats := g.MemoStats(); stats.Hits != 0 || stats.Misses != 0 || len(profiler.Profiles()) != 0 || g.state != nil {
+		t.Errorf("Failed: expect no evaluation of the grammar, got memo stats %+v", stats)
+		return
+	}
+	g.DisableMemo()
+	g.SetProfiler(nil)
+	expected := []string{
+		`L#12: rule [keyword] - alternatives "if" and i"IF" are ambiguous, both match "if"`,
+		`L#7: rule [number] - alternatives integer and digits are ambiguous, both match "0"`,
+	}
+	var actual []string
+	for _, ambiguity := range ambiguities {
+		actual = append(actual, ambiguity.String())
+	}
+	if strings.Join(actual, "\n") != strings.Join(expected, "\n") {
+		t.Errorf("Failed: expected vs actual\n%s\n\n%s", strings.Join(expected, "\n"), strings.Join(actual, "\n"))
+		return
+	}
+	// the witnesses trip the choices at parse time
+	for _, ambiguity := range ambiguities {
+		result := g.GetRule(ambiguity.Rule).Eval(g, NewCharstreamFromString(ambiguity.Witness), NOT_SKIP)
+		if result.Error == nil || !strings.Contains(result.Error.Error(), "ambiguity") {
+			t.Errorf("Failed: expect an ambiguity error for %q, got %v", ambiguity.Witness, result.Error)
+			return
+		}
+	}
+	t.Logf("====> Passed:\n%s", strings.Join(actual, "\n"))
+}
+
+// testDispatch evaluates the rule with and without the dispatch tables, the results must be the same
+func testDispatch(t *testing.T, g *Grammar, ruleName string, text string, expected string) {
+	g.SetDispatch(false)
+	ast1, err1 := g.EvalFrom(ruleName, NewCharstreamFromString(text), LevelRaw)
+	g.SetDispatch(true)
+	ast2, err2 := g.EvalFrom(ruleName, NewCharstreamFromString(text), LevelRaw)
+	if fmt.Sprint(err1) != fmt.Sprint(err2) {
+		t.Errorf("Failed: %q - expect error %v, got %v", text, err1, err2)
+		return
+	}
+	if err2 != nil {
+		if expected != "" {
+			t.Errorf("Failed: %q - %s", text, err2)
+			return
+		}
+		t.Logf("====> Passed: %q - %s", text, err2)
+		return
+	}
+	if ast1.StringTree(nil) != ast2.StringTree(nil) {
+		t.Errorf("Failed: %q - expect\n%s\ngot\n%s", text, ast1.StringTree(nil), ast2.StringTree(nil))
+		return
+	}
+	if string(ast2.Text()) != expected {
+		t.Errorf("Failed: %q - expect %q, got %q", text, expected, string(ast2.Text()))
+		return
+	}
+	t.Logf("====> Passed: %q - %q", text, expected)
+}
+
+func TestDispatch(t *testing.T) {
+	t.Run("t1.keyword", func(t *testing.T) {
+		g, err := NewGrammarFromString(`
+			keyword = "if" | "else" | "while" | i"return" | "elif" > "e"
+			keywords = keyword { keyword }
+		`)
+		if err != nil {
+			t.Errorf("Failed: %s", err)
+			return
+		}
+		testDispatch(t, g, "keywords", "if else  while RETURN elif", "if else while RETURN elif")
+		testDispatch(t, g, "keywords", "e if", "e if")
+		testDispatch(t, g, "keywords", "if x", "")
+		testDispatch(t, g, "keywords", "", "")
+	})
+	t.Run("t2.sticky", func(t *testing.T) {
+		// the failure of "b" makes the choice non-sticky, so spaces are skipped before 'c'
+		g, err := NewGrammarFromString(`
+			abc = ( 'a' | "b" ) 'c'
+			xyz = ( 'x' | 'y' ) 'z'
+		`)
+		if err != nil {
+			t.Errorf("Failed: %s", err)
+			return
+		}
+		testDispatch(t, g, "abc", "a c", "a c")
+		testDispatch(t, g, "abc", "b c", "b c")
+		testDispatch(t, g, "xyz", "xz", "xz")
+		testDispatch(t, g, "xyz", "x z", "")
+	})
+	t.Run("t3.spaces", func(t *testing.T) {
+		g, err := NewGrammarFromString(`
+			line  = "a" | ( "\u000A" 'b' ) | ( \p{Zs} 'c' )
+			lines = line { line }
+		`)
+		if err != nil {
+			t.Errorf("Failed: %s", err)
+			return
+		}
+		testDispatch(t, g, "lines", "a\nb a c", "a\nb a c")
+	})
+	t.Run("t4.skiprule", func(t *testing.T) {
+		g, err := NewGrammarFromString(`
+			@skip ws
+			ws = \[ \u0009] | ( '/*' { !'*/' . } '*/' )
+			item = "x" | ( '/' "y" ) | [ "z" ]
+			items = item "." { item "." }
+		`)
+		if err != nil {
+			t.Errorf("Failed: %s", err)
+			return
+		}
+		testDispatch(t, g, "items", "x. /* c */ x./ y. /**/ .", "x . x . / y . .")
+		testDispatch(t, g, "items", "x. w.", "")
+	})
+	t.Run("t5.ambiguity", func(t *testing.T) {
+		g, err := NewGrammarFromString(`
+			number = ( '0'-'9' { '0'-'9' } ) | '0'-'9' | ( "-" '0'-'9' )
+		`)
+		if err != nil {
+			t.Errorf("Failed: %s", err)
+			return
+		}
+		testDispatch(t, g, "number", "12", "12")
+		testDispatch(t, g, "number", "1", "")
+		result := g.GetRule("number").Eval(g, NewCharstreamFromString("1"), NOT_SKIP)
+		if result.Error == nil || !strings.Contains(result.Error.Error(), "ambiguity found") {
+			t.Errorf("Failed: expect an ambiguity error, got %v", result.Error)
+		}
+		testDispatch(t, g, "number", "-1", "- 1")
+	})
+	t.Run("t6.evaluations", func(t *testing.T) {
+		// peeking at the next char doesn't evaluate the skip rule once more
+		g, err := NewGrammarFromString(`
+			@skip ws
+			ws = \[ \u0009] | ( '/*' { !'*/' . } '*/' )
+			item = "x" | ( '/' "y" ) | [ "z" ]
+			items = item "." { item "." }
+		`)
+		if err != nil {
+			t.Errorf("Failed: %s", err)
+			return
+		}
+		evaluations := func(dispatch bool) string {
+			profiler := NewProfiler()
+			g.SetProfiler(profiler)
+			defer g.SetProfiler(nil)
+			g.SetDispatch(dispatch)
+			defer g.SetDispatch(true)
+			if _, err := g.EvalFrom("items", NewCharstreamFromString("x. /* c */ x./ y. /**/ ."), LevelRaw); err != nil {
+				t.Errorf("Failed: %s", err)
+			}
+			var counts []string
+			for _, profile := range profiler.Profiles() {
+				counts = append(counts, fmt.Sprintf("%s:%d", profile.Rule, profile.Evaluations))
+			}
+			sort.Strings(counts)
+			return strings.Join(counts, " ")
+		}
+		expected := evaluations(false)
+		if actual := evaluations(true); actual != expected {
+			t.Errorf("Failed: expected vs actual evaluations\n%s\n%s", expected, actual)
+			return
+		}
+		t.Logf("====> Passed: %s", expected)
+	})
+}
+
+func TestKeywordTrie(t *testing.T) {
+	g, err := NewGrammarFromString(`
+		keyword  = "if" | "else" | "elif" | "e" | i"return" | i"k" > "fi" | "fin"
+		keywords = keyword { keyword }
+		op       = '+' | '-' | '+='
+		ops      = op 'x' { op 'x' }
+		mixed    = "a" | 'b'
+		twice    = "if" | i"IF"
+	`)
+	if err != nil {
+		t.Errorf("Failed: %s", err)
+		return
+	}
+	t.Run("t1.detect", func(t *testing.T) {
+		analysis := g.Analysis()
+		for name, expected := range map[string]bool{"keyword": true, "op": true, "mixed": false} {
+			choice := g.GetRule(name).(*ChoiceRule)
+			if found := analysis.dispatch[choice].trie != nil; found != expected {
+				t.Errorf("Failed: %s - expect trie %v, got %v", name, expected, found)
+				continue
+			}
+			t.Logf("====> Passed: %s - trie %v", name, expected)
+		}
+	})
+	t.Run("t2.longest", func(t *testing.T) {
+		testDispatch(t, g, "keywords", "else elif e if RETURN Return fin fi", "else elif e if RETURN Return fin fi")
+		testDispatch(t, g, "keywords", "elsee", "else e")
+		testDispatch(t, g, "keywords", "K K", "K K") // the kelvin sign folds to k
+		testDispatch(t, g, "keywords", "if el", "")
+	})
+	t.Run("t3.sticky", func(t *testing.T) {
+		testDispatch(t, g, "ops", "+x+=x-x", "+x+=x-x")
+		testDispatch(t, g, "ops", "+ x", "")
+	})
+	t.Run("t4.ambiguity", func(t *testing.T) {
+		testDispatch(t, g, "twice", "if", "")
+		result := g.GetRule("twice").Eval(g, NewCharstreamFromString("if"), NOT_SKIP)
+		if result.Error == nil || !strings.Contains(result.Error.Error(), "ambiguity found") {
+			t.Errorf("Failed: expect an ambiguity error, got %v", result.Error)
+			return
+		}
+		t.Logf("====> Passed: %s", result.Error)
+	})
+	t.Run("t5.node", func(t *testing.T) {
+		ast, err := g.EvalFrom("keyword", NewCharstreamFromString("  elif"), LevelRaw)
+		if err != nil {
+			t.Errorf("Failed: %s", err)
+			return
+		}
+		node := ast.Nodes[0]
+		if node.RuleType != TypeChoice || len(node.ChildNodes) != 1 || node.ChildNodes[0].RuleType != TypeString ||
+			string(node.ChildNodes[0].Chars) != "elif" || node.Sticky {
+			t.Errorf("Failed: expect a non-sticky choice node of a string node\n%s", ast.StringTree(nil))
+			return
+		}
+		t.Logf("====> Passed")
+	})
+	t.Run("t6.ignorecase", func(t *testing.T) {
+		g, err := NewGrammarFromString(`
+			@ignorecase
+			keyword  = "select" | "from" | "where"
+			keywords = keyword { keyword }
+		`)
+		if err != nil {
+			t.Errorf("Failed: %s", err)
+			return
+		}
+		testDispatch(t, g, "keywords", "SELECT From where", "SELECT From where")
+	})
+	t.Run("t7.nodes", func(t *testing.T) {
+		// the nodes built by the walk are the ones of the evaluated literals, annotations included
+		g, err := NewGrammarFromString(`
+			op  = #"(" | ~")" | $i"and" > "=" | "=="
+			ops = op { op }
+			chr = #'a' | 'ab' > ~i'b'
+			chs = chr { chr }
+		`)
+		if err != nil {
+			t.Errorf("Failed: %s", err)
+			return
+		}
+		var describe func(node *Node) string
+		describe = func(node *Node) string {
+			text := fmt.Sprintf("%s:%s:%q:%s:%v%v%v%v", node.RuleType, node.RuleName, string(node.Chars), node.Position,
+				node.Sticky, node.Virtual, node.NonData, node.Tokenized)
+			for _, child := range node.ChildNodes {
+				text = text + "(" + describe(child) + ")"
+			}
+			return text
+		}
+		for _, name := range []string{"op", "chr"} {
+			if g.Analysis().dispatch[g.GetRule(name).(*ChoiceRule)].trie == nil {
+				t.Errorf("Failed: %s - expect a trie", name)
+				return
+			}
+		}
+		for rule, sample := range map[string]string{"ops": "( AND ) == =", "chs": "abaBb"} {
+			testDispatch(t, g, rule, sample, sample)
+			var trees []string
+			for _, dispatch := range []bool{false, true} {
+				g.SetDispatch(dispatch)
+				ast, err := g.EvalFrom(rule, NewCharstreamFromString(sample), LevelRaw)
+				if err != nil {
+					t.Errorf("Failed: %s", err)
+					return
+				}
+				trees = append(trees, describe(ast.Nodes[0]))
+			}
+			if trees[0] != trees[1] {
+				t.Errorf("Failed: %s - expected vs actual nodes\n%s\n%s", sample, trees[0], trees[1])
+				return
+			}
+		}
+		t.Logf("====> Passed")
+	})
+}
+
+func BenchmarkKeywordTrie(b *testing.B) {
+	var keywords []string
+	for i := 0; i < 300; i++ {
+		keywords = append(keywords, fmt.Sprintf(`"kw%d"`, i))
+	}
+	g, err := NewGrammarFromString(fmt.Sprintf("keyword = %s\nkeywords = keyword { keyword }", strings.Join(keywords, " | ")))
+	if err != nil {
+		b.Fatalf("Failed: %s", err)
+	}
+	var sample strings.Builder
+	for i := 0; i < 1000; i++ {
+		sample.WriteString(fmt.Sprintf("kw%d ", i*7%300))
+	}
+	run := func(b *testing.B) {
+		for i := 0; i < b.N; i++ {
+			_, err := g.EvalFrom("keywords", NewCharstreamFromString(sample.String()), LevelRaw)
+			if err != nil {
+				b.Fatalf("Failed: %s", err)
+			}
+		}
+	}
+	b.Run("trie", run)
+	b.Run("nodispatch", func(b *testing.B) {
+		g.SetDispatch(false)
+		defer g.SetDispatch(true)
+		run(b)
+	})
+	b.Run("notrie", func(b *testing.B) {
+		// the dispatch by the next char only, with the literals evaluated
+		dispatch := g.Analysis().dispatch[g.GetRule("keyword").(*ChoiceRule)]
+		trie := dispatch.trie
+		dispatch.trie = nil
+		defer func() { dispatch.trie = trie }()
+		run(b)
+	})
+}
+
+func TestCompile(t *testing.T) {
+	g, err := NewGrammarFromString(`
+		@skip ws
+		ws      = \[ \u0009\u000A] | ( '/*' { !'*/' . } '*/' )
+		number  = '0'-'9' { '0'-'9' }
+		keyword = "let" | "print"
+		name    = ( \[a-z] { \[a-z] } ) -- keyword
+		expr    = ( expr "+" term ) | term
+		term    = ( term "*" factor ) | factor
+		factor  = number | name | ( "(" expr ")" )
+		stmt    = ( "let" name "=" expr ";" ) | ( "print" expr ";" )
+		program = stmt { stmt }
+	`)
+	if err != nil {
+		t.Errorf("Failed: %s", err)
+		return
+	}
+	g.SetStartRule("program")
+	g.EnableMemo(0)
+	parser, err := g.Compile()
+	if err != nil {
+		t.Errorf("Failed: %s", err)
+		return
+	}
+	samples := []string{
+		"let x = 1 + 2 * 3; print x;",
+		"let y = (x + 1) * /* twice */ 2;\nprint y * y + x;",
+		"print 1 + ;",
+		"let print = 1;",
+		"print ((1));",
+	}
+	// the results of the grammar itself are expected
+	expected := make([]string, len(samples))
+	for i, sample := range samples {
+		ast, err := g.Eval(NewCharstreamFromString(sample), LevelBasic)
+		if err != nil {
+			expected[i] = err.Error()
+		} else {
+			expected[i] = ast.StringTree(nil)
+		}
+	}
+	evalSample := func(i int) string {
+		ast, err := parser.Eval(NewCharstreamFromString(samples[i]), LevelBasic)
+		if err != nil {
+			return err.Error()
+		}
+		return ast.StringTree(nil)
+	}
+	t.Run("t1.resolved", func(t *testing.T) {
+		for name, record := range parser.grammar.ruleRecords {
+			walkRule(record.rule, func(rule IRule) {
+				if ref, ok := rule.(*ReferenceRule); ok && ref.record == nil {
+					t.Errorf("Failed: reference %s in rule %s not resolved", ref.refName, name)
+				}
+			})
+		}
+		// the rules of the grammar are not changed
+		for name, record := range g.ruleRecords {
+			walkRule(record.rule, func(rule IRule) {
+				if ref, ok := rule.(*ReferenceRule); ok && ref.record != nil {
+					t.Errorf("Failed: reference %s in rule %s of the grammar resolved", ref.refName, name)
+				}
+			})
+		}
+		t.Logf("====> Passed")
+	})
+	t.Run("t2.concurrent", func(t *testing.T) {
+		var wg sync.WaitGroup
+		failures := make(chan string, 100)
+		for n := 0; n < 8; n++ {
+			wg.Add(1)
+			go func(n int) {
+				defer wg.Done()
+				for round := 0; round < 20; round++ {
+					i := (n + round) % len(samples)
+					if actual := evalSample(i); actual != expected[i] {
+						failures <- fmt.Sprintf("%q - expect\n%s\ngot\n%s", samples[i], expected[i], actual)
+						return
+					}
+				}
+			}(n)
+		}
+		wg.Wait()
+		close(failures)
+		for failure := range failures {
+			t.Errorf("Failed: %s", failure)
+		}
+		t.Logf("====> Passed")
+	})
+	t.Run("t3.frozen", func(t *testing.T) {
+		g.SetStartRule("expr")
+		if _, err := g.AddRule(`unused = "x"`); err != nil {
+			t.Errorf("Failed: %s", err)
+			return
+		}
+		defer g.SetStartRule("program")
+		for i := range samples {
+			if actual := evalSample(i); actual != expected[i] {
+				t.Errorf("Failed: %q - the parser is changed by the grammar", samples[i])
+				return
+			}
+		}
+		if parser.grammar.GetRecord("unused") != nil {
+			t.Errorf("Failed: the rule added to the grammar is found in the parser")
+			return
+		}
+		t.Logf("====> Passed")
+	})
+	t.Run("t4.invalid", func(t *testing.T) {
+		g, err := NewGrammarFromString(`a = b`)
+		if err == nil {
+			_, err = g.Compile()
+		}
+		if err == nil || !strings.Contains(err.Error(), "referenced but not defined") {
+			t.Errorf("Failed: expect an undefined rule error, got %v", err)
+			return
+		}
+		t.Logf("====> Passed: %s", err)
+	})
+	t.Run("t5.memoStats", func(t *testing.T) {
+		stats := g.MemoStats()
+		before := parser.MemoStats()
+		evalSample(0)
+		after := parser.MemoStats()
+		if after.Misses <= before.Misses || g.MemoStats() != stats {
+			t.Errorf("Failed: expect the stats of the parser only grow, got %+v -> %+v", before, after)
+			return
+		}
+		t.Logf("====> Passed: %+v", after)
+	})
+}
+
+func TestLimits(t *testing.T) {
+	g, err := NewGrammarFromString(`
+		@start value
+		value = ( "[" [ value { "," value } ] "]" ) | '0'-'9' | text
+		text  = < "'" "'" >
+	`)
+	if err != nil {
+		t.Errorf("Failed: %s", err)
+		return
+	}
+	nested := strings.Repeat("[", 200) + "1" + strings.Repeat("]", 200)
+	long := "'" + strings.Repeat("x", 1000)
+	eval := func(limits Limits, text string) error {
+		g.SetLimits(limits)
+		defer g.SetLimits(Limits{})
+		_, err := g.Eval(NewCharstreamFromString(text), LevelBasic)
+		return err
+	}
+	t.Run("t1.depth", func(t *testing.T) {
+		if err := eval(Limits{}, nested); err != nil {
+			t.Errorf("Failed: %s", err)
+			return
+		}
+		var depthErr *DepthLimitError
+		if err := eval(Limits{MaxDepth: 50}, nested); !errors.As(err, &depthErr) || depthErr.Rule != "value" {
+			t.Errorf("Failed: expect a depth limit error, got %v", err)
+			return
+		}
+		t.Logf("====> Passed: %s", depthErr)
+	})
+	t.Run("t2.evaluations", func(t *testing.T) {
+		var evaluationErr *EvaluationLimitError
+		if err := eval(Limits{MaxEvaluations: 100}, nested); !errors.As(err, &evaluationErr) {
+			t.Errorf("Failed: expect an evaluation limit error, got %v", err)
+			return
+		}
+		t.Logf("====> Passed: %s", evaluationErr)
+	})
+	t.Run("t3.input", func(t *testing.T) {
+		if err := eval(Limits{MaxInputLength: 9}, "[1,[2],3]"); err != nil {
+			t.Errorf("Failed: %s", err)
+			return
+		}
+		var inputErr *InputLimitError
+		if err := eval(Limits{MaxInputLength: 8}, "[1,[2],3]"); !errors.As(err, &inputErr) {
+			t.Errorf("Failed: expect an input limit error, got %v", err)
+			return
+		}
+		// the block reads chars up to the limit only
+		if err := eval(Limits{MaxInputLength: 100}, long); !errors.As(err, &inputErr) {
+			t.Errorf("Failed: expect an input limit error, got %v", err)
+			return
+		}
+		t.Logf("====> Passed: %s", inputErr)
+	})
+	t.Run("t4.context", func(t *testing.T) {
+		ctx, cancel := context.WithCancel(context.Background())
+		cancel()
+		_, err := g.EvalContext(ctx, NewCharstreamFromString(nested), LevelBasic)
+		if !errors.Is(err, context.Canceled) {
+			t.Errorf("Failed: expect the context canceled, got %v", err)
+			return
+		}
+		ctx, cancel = context.WithDeadline(context.Background(), time.Now().Add(-time.Second))
+		defer cancel()
+		_, err = g.EvalFromContext(ctx, "value", NewCharstreamFromString(nested), LevelBasic)
+		if !errors.Is(err, context.DeadlineExceeded) {
+			t.Errorf("Failed: expect the context deadline exceeded, got %v", err)
+			return
+		}
+		// the grammar works again after an evaluation is stopped
+		_, err = g.EvalContext(context.Background(), NewCharstreamFromString(nested), LevelBasic)
+		if err != nil {
+			t.Errorf("Failed: %s", err)
+			return
+		}
+		t.Logf("====> Passed")
+	})
+	t.Run("t5.parser", func(t *testing.T) {
+		g.SetLimits(Limits{MaxDepth: 50})
+		parser, err := g.Compile()
+		g.SetLimits(Limits{})
+		if err != nil {
+			t.Errorf("Failed: %s", err)
+			return
+		}
+		_, err = parser.EvalContext(context.Background(), NewCharstreamFromString(nested), LevelBasic)
+		var depthErr *DepthLimitError
+		if !errors.As(err, &depthErr) {
+			t.Errorf("Failed: expect a depth limit error, got %v", err)
+			return
+		}
+		_, _, err = parser.EvalWithRecovery(NewCharstreamFromString(nested), LevelBasic)
+		if !errors.As(err, &depthErr) {
+			t.Errorf("Failed: expect a depth limit error, got %v", err)
+			return
+		}
+		t.Logf("====> Passed: %s", depthErr)
 	})
-	t.Run("test26", func(t *testing.T) {
-		evalRule(t, ExpectedText("0xFF + 45 - 0b0101"), grammar, "expr", " 0xFF+45-0b0101")
+}
+
+// eventTracer records the trace events as strings
+type eventTracer struct {
+	events []string
+}
+
+func (inst *eventTracer) Enter(event *TraceEvent) {
+	inst.add("enter", event, fmt.Sprintf("%s %s", event.RuleType, event.Position))
+}
+
+func (inst *eventTracer) Match(event *TraceEvent) {
+	inst.add("match", event, fmt.Sprintf("%d-%d", event.Cursor, event.End))
+}
+
+func (inst *eventTracer) Fail(event *TraceEvent) {
+	inst.add("fail", event, fmt.Sprintf("%d", event.Cursor))
+}
+
+func (inst *eventTracer) Exit(event *TraceEvent) {
+	inst.add("exit", event, "")
+}
+
+func (inst *eventTracer) add(kind string, event *TraceEvent, detail string) {
+	inst.events = append(inst.events, strings.TrimSpace(fmt.Sprintf("%d %s %s %s", event.Depth, kind, event.RuleName, detail)))
+}
+
+func TestTracer(t *testing.T) {
+	g, err := NewGrammarFromString(`
+		@start pair
+		pair   = number "," ( number | word )
+		number = '0'-'9' { '0'-'9' }
+		word   = 'a'-'z' { 'a'-'z' }
+	`)
+	if err != nil {
+		t.Errorf("Failed: %s", err)
+		return
+	}
+	t.Run("t1.events", func(t *testing.T) {
+		tracer := &eventTracer{}
+		g.SetTracer(tracer)
+		defer g.SetTracer(nil)
+		g.SetDispatch(false)
+		defer g.SetDispatch(true)
+		if _, err := g.Eval(NewCharstreamFromString("12,\n ab"), LevelBasic); err != nil {
+			t.Errorf("Failed: %s", err)
+			return
+		}
+		expected := []string{
+			"0 enter pair concatenate L1:1",
+			"1 enter number concatenate L1:1",
+			"1 match number 0-2",
+			"1 exit number",
+			"1 enter number concatenate L1:4",
+			"1 fail number 3",
+			"1 exit number",
+			"1 enter word concatenate L1:4",
+			"1 match word 3-7",
+			"1 exit word",
+			"0 match pair 0-7",
+			"0 exit pair",
+		}
+		if strings.Join(tracer.events, "\n") != strings.Join(expected, "\n") {
+			t.Errorf("Failed: expected vs actual events\n%s\n\n%s", strings.Join(expected, "\n"), strings.Join(tracer.events, "\n"))
+			return
+		}
+		t.Logf("====> Passed")
 	})
-	t.Run("test27", func(t *testing.T) {
-		evalRule(t, ExpectedText("0xF45A"), grammar, "integer_hex", "0xF45A")
+	t.Run("t2.text", func(t *testing.T) {
+		var buf strings.Builder
+		g.SetTracer(NewTextTracer(&buf))
+		defer g.SetTracer(nil)
+		_, err := g.Eval(NewCharstreamFromString("12,x"), LevelBasic)
+		if err != nil {
+			t.Errorf("Failed: %s", err)
+			return
+		}
+		expected := "> pair (concatenate) at L1:1\n" +
+			"  > number (concatenate) at L1:1\n" +
+			"  < number matched 0-2\n" +
+			"  > word (concatenate) at L1:4\n" +
+			"  < word matched 3-4\n" +
+			"< pair matched 0-4\n"
+		if buf.String() != expected {
+			t.Errorf("Failed: expected vs actual\n%s\n%s", expected, buf.String())
+			return
+		}
+		buf.Reset()
+		if _, err := g.Eval(NewCharstreamFromString("12;"), LevelBasic); err == nil {
+			t.Errorf("Failed: expect an error")
+			return
+		}
+		if !strings.Contains(buf.String(), "< pair failed at L1:1: ") {
+			t.Errorf("Failed: expect the failure of pair traced\n%s", buf.String())
+			return
+		}
+		t.Logf("====> Passed:\n%s", buf.String())
 	})
-	t.Run("test28", func(t *testing.T) {
-		evalRule(t, ExpectedText("0xF45A + 12345"), grammar, "expr", "0xF45A+12345.67")
+	t.Run("t3.parser", func(t *testing.T) {
+		tracer := &eventTracer{}
+		g.SetTracer(tracer)
+		parser, err := g.Compile()
+		g.SetTracer(nil)
+		if err != nil {
+			t.Errorf("Failed: %s", err)
+			return
+		}
+		if _, err := parser.Eval(NewCharstreamFromString("1,2"), LevelBasic); err != nil {
+			t.Errorf("Failed: %s", err)
+			return
+		}
+		if len(tracer.events) == 0 || tracer.events[0] != "0 enter pair concatenate L1:1" {
+			t.Errorf("Failed: expect the evaluation traced, got %v", tracer.events)
+			return
+		}
+		t.Logf("====> Passed")
 	})
 }
 
-func TestArithmeticRule(t *testing.T) {
-	grammar, err := NewGrammarFromString(`
-		SPACE   = \u0020  // space
-		TAB     = \u0009  // horizontal tab
-		NL      = \u000A  // new line
-		CR      = \u000D  // carriage return
-		space       = ~{ SPACE | TAB | NL | CR }
-		digit_dec   = '0' | '1' | '2' | '3' | '4' | '5' | '6' | '7' | '8' | '9'
-		digit_hex   = '0' | '1' | '2' | '3' | '4' | '5' | '6' | '7' | '8' | '9' | 'A' | 'B' | 'C' | 'D' | 'E' | 'F' | 'a' | 'b' | 'c' | 'd' | 'e' | 'f'
-		digit_oct   = '0' | '1' | '2' | '3' | '4' | '5' | '6' | '7'
-		digit_bin   = '0' | '1'
-		integer_dec = digit_dec { digit_dec } 
-		integer_hex = "0x" digit_hex { digit_hex }
-		integer_oct = "0o" digit_oct { digit_oct }
-		integer_bin = "0b" digit_bin { digit_bin }
-		float       = digit_dec '.' digit_dec { digit_dec }
-		integer     = integer_dec | integer_oct | integer_hex | integer_bin
-		literal		= integer | float
-		factor		= literal | ( "(" expr ")" )
-		term		= factor { ( "*" | "/" ) factor }
-		expr		= term { ("+" | "-") term }
-		exprs		= expr
-		// spaces		= { {space}+ "efg" }
-		spaces		= { { ~{'a'} }+ "efg" }
+func TestProfiler(t *testing.T) {
+	g, err := NewGrammarFromString(`
+		@start stmt
+		stmt = call | name
+		call = name "(" ")"
+		name = 'a'-'z' { 'a'-'z' }
 	`)
 	if err != nil {
 		t.Errorf("Failed: %s", err)
 		return
 	}
-	t.Logf("\nGrammar:%s", grammar.Serialize(false))
-	evalRule(t, ExpectedText("12"), grammar, "term", "12")
-	evalRule(t, ExpectedText("12"), grammar, "term", " 12 ")
-	evalRule(t, ExpectedText("12 * 3"), grammar, "term", " 12 *    3 ")
-	evalRule(t, ExpectedText("1 / 12 * 12"), grammar, "term", "1/12*12")
-	evalRule(t, ExpectedText("12"), grammar, "expr", "12")
-	evalRule(t, ExpectedText("12 + 1"), grammar, "expr", "12 +   1")
-	evalRule(t, ExpectedText("12"), grammar, "literal", "12 +   1")
-	evalRule(t, ExpectedText("12 * 3 / 4"), grammar, "expr", "12*3/4")
-	evalRule(t, ExpectedText("2 - 12 / 4"), grammar, "expr", "2-12/4 ")
-	evalRule(t, ExpectedText("3 / 4 - 12 / 4"), grammar, "expr", " 3/4 -12/4 ")
-	evalRule(t, ExpectedText("( 4 + 5 )"), grammar, "expr", "(4 +5) ")
-	evalRule(t, ExpectedText("( 4 + 5 ) / 5"), grammar, "expr", " (4 +5) /5  ")
-	evalRule(t, ExpectedText("124 * 23 - 23 + 3 / 4 - 12 / 4"), grammar, "expr", "124*23 - 23 + 3/4 -12/4 ")
-	evalRule(t, ExpectedText("12 - 2 * 3"), grammar, "expr", " 12-2   *3  ")
-	evalRule(t, ExpectedText(""), grammar, "spaces", "")
+	profiler := NewProfiler()
+	g.SetProfiler(profiler)
+	defer g.SetProfiler(nil)
+	profiles := func() map[string]RuleProfile {
+		result := make(map[string]RuleProfile)
+		for _, profile := range profiler.Profiles() {
+			profile.Time = 0
+			result[profile.Rule] = *profile
+		}
+		return result
+	}
+	t.Run("t1.eval", func(t *testing.T) {
+		profiler.Reset()
+		if _, err := g.Eval(NewCharstreamFromString("abc"), LevelBasic); err != nil {
+			t.Errorf("Failed: %s", err)
+			return
+		}
+		expected := map[string]RuleProfile{
+			"stmt": {Rule: "stmt", Evaluations: 1, Matches: 1},
+			"call": {Rule: "call", Evaluations: 1, Failures: 1, Backtracked: 3}, // fails at the missing "("
+			"name": {Rule: "name", Evaluations: 2, Matches: 2},
+		}
+		if actual := profiles(); fmt.Sprint(actual) != fmt.Sprint(expected) {
+			t.Errorf("Failed: expected vs actual\n%v\n%v", expected, actual)
+			return
+		}
+		if profile := profiler.Profiles()[0]; profile.Rule != "stmt" || profile.Time <= 0 {
+			t.Errorf("Failed: expect stmt the slowest, got %v", profile)
+			return
+		}
+		t.Logf("====> Passed")
+	})
+	t.Run("t2.embed", func(t *testing.T) {
+		profiler.Reset()
+		g.EvalEmbed("name", "12 ab 34 cd")
+		if name := profiles()["name"]; name.Matches != 2 || name.Failures == 0 {
+			t.Errorf("Failed: expect 2 matches and some failures, got %v", name)
+			return
+		}
+		t.Logf("====> Passed")
+	})
+	t.Run("t3.parser", func(t *testing.T) {
+		profiler.Reset()
+		parser, err := g.Compile()
+		if err != nil {
+			t.Errorf("Failed: %s", err)
+			return
+		}
+		var wg sync.WaitGroup
+		for i := 0; i < 8; i++ {
+			wg.Add(1)
+			go func() {
+				defer wg.Done()
+				parser.Eval(NewCharstreamFromString("f()"), LevelBasic)
+			}()
+		}
+		wg.Wait()
+		if call := profiles()["call"]; call.Evaluations != 8 || call.Matches != 8 {
+			t.Errorf("Failed: expect 8 matches of call, got %v", call)
+			return
+		}
+		t.Logf("====> Passed")
+	})
+	t.Run("t4.table", func(t *testing.T) {
+		var buf strings.Builder
+		if err := profiler.WriteTable(&buf, 1); err != nil {
+			t.Errorf("Failed: %s", err)
+			return
+		}
+		lines := strings.Split(strings.TrimSpace(buf.String()), "\n")
+		if len(lines) != 2 || !strings.HasPrefix(lines[0], "rule") || !strings.HasPrefix(lines[1], "stmt") {
+			t.Errorf("Failed: expect the header and stmt\n%s", buf.String())
+			return
+		}
+		t.Logf("====> Passed:\n%s", buf.String())
+	})
 }
 
 func TestBlock(t *testing.T) {
@@ -719,8 +2384,7 @@ func TestTokenized(t *testing.T) {
 		t.Logf("====> RULE  : %s = %s", ruleName, rule.String())
 		cs := NewCharstreamFromString(sample)
 		result := rule.Eval(grammar, cs, SUGGEST_SKIP)
-		t.Logf("CharsRead:%s*", string(result.CharsRead))
-		t.Logf("CharsUnused:%s*", string(result.CharsUnused))
+		t.Logf("Start:%d, End:%d", result.Start, result.End)
 		if result.Node == nil {
 			if expected == "" {
 				t.Logf("====> Passed: %s", result.Error)
@@ -1016,5 +2680,333 @@ func TestErrorReport(t *testing.T) {
 			t.Errorf("Failed: unexpected AST\n%s", ast.StringTree(nil))
 		}
 	})
+	tester := func(t *testing.T, sample string, line, col int, expected []string, stack []string, text string) {
+		t.Logf("====> SAMPLE: %s", sample)
+		_, err := g.Eval(NewCharstreamFromString(sample), LevelBasic)
+		parseErr, ok := err.(*ParseError)
+		if !ok {
+			t.Errorf("Failed: expect a ParseError, got %v", err)
+			return
+		}
+		t.Logf("ParseError: %s", parseErr)
+		if !parseErr.Position.is(line, col) {
+			t.Errorf("Failed: expect position L%d:%d, got %s", line, col, parseErr.Position)
+			return
+		}
+		if strings.Join(parseErr.Expected, " ") != strings.Join(expected, " ") {
+			t.Errorf("Failed: expect %v expected, got %v", expected, parseErr.Expected)
+			return
+		}
+		if strings.Join(parseErr.RuleStack, " ") != strings.Join(stack, " ") {
+			t.Errorf("Failed: expect rule stack %v, got %v", stack, parseErr.RuleStack)
+			return
+		}
+		if parseErr.Text != text {
+			t.Errorf("Failed: expect offending text %q, got %q", text, parseErr.Text)
+			return
+		}
+		t.Logf("====> Passed")
+	}
+	t.Run("t102.parseError", func(t *testing.T) {
+		expected := []string{`"["`, `"false"`, `"null"`, `"true"`, `"{"`, `'"'`, `'-'`,
+			`'0'`, `'1'`, `'2'`, `'3'`, `'4'`, `'5'`, `'6'`, `'7'`, `'8'`, `'9'`}
+		stack := []string{"json", "value", "object", "kv", "value", "literal", "number", "float", "integer", "digit"}
+		tester(t, "{ \"a\": true,\n \"b\": nul }", 2, 7, expected, stack, "nul }")
+	})
+	t.Run("t103.parseError", func(t *testing.T) {
+		stack := []string{"json", "value", "array", "value", "literal", "number", "float"}
+		tester(t, "[ 1, 2", 1, 7, []string{`"]"`, `'.'`}, stack, "")
+	})
+	t.Run("t104.render", func(t *testing.T) {
+		_, err := g.Eval(NewCharstreamFromString("[ 1,\n\t[ true, nul ] ]"), LevelBasic)
+		expected := "sample.json:2:10: error: unexpected `nul ] ]`\n" +
+			"2 | \t[ true, nul ] ]\n" +
+			"  | \t        ^\n" +
+			"expected \"[\", \"false\", \"null\", \"true\", \"{\", '\"', '-', '0' or 9 more\n"
+		actual := RenderError(err, "sample.json", false)
+		if actual != expected {
+			t.Errorf("Failed: expected vs actual\n%s\n%s", expected, actual)
+			return
+		}
+		colored := RenderError(err, "sample.json", true)
+		if !strings.Contains(colored, ansiRed) {
+			t.Errorf("Failed: expect colours\n%s", colored)
+			return
+		}
+		t.Logf("====> Passed:\n%s", actual)
+	})
+	t.Run("t105.eol", func(t *testing.T) {
+		g, err := NewGrammarFromString(`
+			@skip sp
+			sp   = ' '
+			line = "key" "=" "value" \u000A
+		`)
+		if err != nil {
+			t.Errorf("Failed: %s", err)
+			return
+		}
+		samples := map[string]string{"key =\nvalue\n": "\n", "key =\r\nvalue\n": "\r\n", "key = x\r\n": "x"}
+		for sample, expected := range samples {
+			_, err = g.Eval(NewCharstreamFromString(sample), LevelBasic)
+			parseErr, ok := err.(*ParseError)
+			if !ok {
+				t.Errorf("Failed: expect a ParseError, got %v", err)
+				return
+			}
+			if parseErr.Text != expected || parseErr.EOF {
+				t.Errorf("Failed: expect offending text %q, got %q", expected, parseErr.Text)
+				return
+			}
+			// the line break is raw in the text, escaped in the message
+			if message := fmt.Sprintf("unexpected `%s`", printable(expected)); !strings.Contains(parseErr.Error(), message) ||
+				!strings.Contains(parseErr.Render("", false), message) {
+				t.Errorf("Failed: expect %s in the message, got %s", message, parseErr)
+				return
+			}
+			t.Logf("ParseError: %s", parseErr)
+		}
+		t.Logf("====> Passed")
+	})
+	t.Run("t106.renderControls", func(t *testing.T) {
+		g, err := NewGrammarFromString(`
+			@skip sp
+			sp   = ' '
+			line = "key" "=" "value" \u000A
+		`)
+		if err != nil {
+			t.Errorf("Failed: %s", err)
+			return
+		}
+		samples := map[string]string{
+			"key =\nvalue\n":     "1:6: error: unexpected `\\n`\n1 | key =\n  |      ^\n",
+			"key =\tvalue\x01\n": "1:6: error: unexpected `\\tvalue\\u0001`\n1 | key =\tvalue\x01\n  |      ^\n",
+		}
+		for sample, expected := range samples {
+			_, err = g.Eval(NewCharstreamFromString(sample), LevelBasic)
+			actual := RenderError(err, "", false)
+			if !strings.HasPrefix(actual, expected) {
+				t.Errorf("Failed: expected vs actual\n%s\n%s", expected, actual)
+				return
+			}
+			t.Logf("Rendered:\n%s", actual)
+		}
+		t.Logf("====> Passed")
+	})
+}
+
+func TestRecovery(t *testing.T) {
+	g, err := NewGrammarFromString(`
+		@sync semicolon // resume after a statement
+		semicolon = ";"
+		ident     = 'a'-'z' { 'a'-'z' }
+		number    = '0'-'9' { '0'-'9' }
+		stmt      = ident "=" number semicolon
+	`)
+	if err != nil {
+		t.Errorf("Failed: %s", err)
+		return
+	}
+	tester := func(t *testing.T, sample string, expectedNodes []string, expectedErrors []string) {
+		t.Logf("====> SAMPLE: %s", sample)
+		ast, diagnostics, err := g.EvalWithRecovery(NewCharstreamFromString(sample), LevelBasic)
+		if err != nil {
+			t.Errorf("Failed: %s", err)
+			return
+		}
+		var nodes []string
+		for _, node := range ast.Nodes {
+			nodes = append(nodes, fmt.Sprintf("%s:%s", node.RuleType, string(node.Text())))
+		}
+		if strings.Join(nodes, "|") != strings.Join(expectedNodes, "|") {
+			t.Errorf("Failed: expected vs actual nodes\n%v\n%v", expectedNodes, nodes)
+			return
+		}
+		var errors []string
+		for _, diagnostic := range diagnostics {
+			errors = append(errors, diagnostic.Position.String())
+		}
+		if strings.Join(errors, "|") != strings.Join(expectedErrors, "|") {
+			t.Errorf("Failed: expected vs actual errors\n%v\n%v", expectedErrors, errors)
+			return
+		}
+		t.Logf("====> Passed")
+	}
+	t.Run("t1.noError", func(t *testing.T) {
+		tester(t, "a = 1; b = 2;", []string{"concatenate:a = 1 ;", "concatenate:b = 2 ;"}, nil)
+	})
+	t.Run("t2.errors", func(t *testing.T) {
+		tester(t, "a = 1; b = ; c = 3;\nd = x y; e = 5;",
+			[]string{"concatenate:a = 1 ;", "error:b = ;", "concatenate:c = 3 ;", "error:d = x y;", "concatenate:e = 5 ;"},
+			[]string{"L1:12", "L2:5"})
+	})
+	t.Run("t3.noSync", func(t *testing.T) {
+		tester(t, "a = 1; b = 2 c = 3", []string{"concatenate:a = 1 ;", "error:b = 2 c = 3"}, []string{"L1:14"})
+	})
+	t.Run("t4.evalRaw", func(t *testing.T) {
+		_, err := g.EvalRaw(NewCharstreamFromString("a = 1; b = ; c = 3;"))
+		if _, ok := err.(*ParseError); !ok {
+			t.Errorf("Failed: expect a ParseError, got %v", err)
+			return
+		}
+		t.Logf("====> Passed: %s", err)
+	})
+	t.Run("t5.directive", func(t *testing.T) {
+		_, err := NewGrammarFromString("@sync end\nstmt = 'a'")
+		if err == nil || !strings.Contains(err.Error(), "sync rule 'end' not defined") {
+			t.Errorf("Failed: expect undefined sync rule error, got %v", err)
+			return
+		}
+		_, err = NewGrammarFromString("@unknown end\nstmt = 'a'")
+		if err == nil || !strings.Contains(err.Error(), "L#1: unknown directive @unknown") {
+			t.Errorf("Failed: expect unknown directive error, got %v", err)
+			return
+		}
+		t.Logf("====> Passed")
+	})
+	nested, err := NewGrammarFromString(`
+		@sync semicolon
+		semicolon = ";"
+		ident     = 'a'-'z' { 'a'-'z' }
+		number    = '0'-'9' { '0'-'9' }
+		stmt      = ( ident "=" number semicolon ) | block
+		block     = "{" { stmt } "}"
+		program   = "begin" { stmt } "end"
+	`)
+	if err != nil {
+		t.Errorf("Failed: %s", err)
+		return
+	}
+	t.Run("t6.nested", func(t *testing.T) {
+		// the broken statements are skipped in the statement lists, the program still matches
+		sample := "begin a = 1; { b = ; c = 3; { d = x; } } e = 5; end"
+		ast, diagnostics, err := nested.EvalWithRecovery(NewCharstreamFromString(sample), LevelBasic)
+		if err != nil {
+			t.Errorf("Failed: %s", err)
+			return
+		}
+		if len(ast.Nodes) != 1 || ast.Nodes[0].RuleName != "program" || string(ast.Nodes[0].Text()) != "begin a = 1 ; { b = ; c = 3 ; { d = x; } } e = 5 ; end" {
+			t.Errorf("Failed: expect 1 program node\n%s", ast.StringTree(nil))
+			return
+		}
+		var errorNodes []string
+		var walk func(node *Node)
+		walk = func(node *Node) {
+			if node.RuleType == TypeError {
+				errorNodes = append(errorNodes, fmt.Sprintf("%s:%s", node.Position, string(node.Chars)))
+			}
+			for _, child := range node.ChildNodes {
+				walk(child)
+			}
+		}
+		walk(ast.Nodes[0])
+		if strings.Join(errorNodes, "|") != "L1:16:b = ;|L1:31:d = x;" {
+			t.Errorf("Failed: unexpected error nodes %v", errorNodes)
+			return
+		}
+		var errors []string
+		for _, diagnostic := range diagnostics {
+			errors = append(errors, diagnostic.Position.String())
+		}
+		if strings.Join(errors, "|") != "L1:20|L1:35" {
+			t.Errorf("Failed: unexpected errors %v", errors)
+			return
+		}
+		t.Logf("====> Passed")
+	})
+	t.Run("t7.nestedNoSync", func(t *testing.T) {
+		// no sync rule match in the block, the failure is recovered at the top level
+		ast, diagnostics, err := nested.EvalWithRecovery(NewCharstreamFromString("begin { a = 1 } end"), LevelBasic)
+		if err != nil {
+			t.Errorf("Failed: %s", err)
+			return
+		}
+		if len(ast.Nodes) != 1 || ast.Nodes[0].RuleType != TypeError || len(diagnostics) != 1 {
+			t.Errorf("Failed: expect 1 error node and 1 error\n%s", ast.StringTree(nil))
+			return
+		}
+		t.Logf("====> Passed: %s", diagnostics[0])
+	})
+	t.Run("t8.trailingSpaces", func(t *testing.T) {
+		// the insignificant chars after a sticky node are not a failure, nor an empty error node
+		g, err := NewGrammarFromString(`
+			@sync semicolon
+			semicolon = ';'
+			stmt      = 'a'-'z' { 'a'-'z' } semicolon
+		`)
+		if err != nil {
+			t.Errorf("Failed: %s", err)
+			return
+		}
+		ast, diagnostics, err := g.EvalWithRecovery(NewCharstreamFromString("ab;cd;  \n"), LevelBasic)
+		if err != nil {
+			t.Errorf("Failed: %s", err)
+			return
+		}
+		if len(ast.Nodes) != 1 || len(diagnostics) != 0 {
+			t.Errorf("Failed: expect the merged sticky node and no error, got %d error(s)\n%s", len(diagnostics), ast.StringTree(nil))
+			return
+		}
+		t.Logf("====> Passed")
+	})
+}
 
+func TestStartRule(t *testing.T) {
+	grammarText := `
+		digits = '0'-'9' { '0'-'9' }
+		number = [ '-' ] digits
+		test   = '0'-'9' { '0'-'9' } // a helper rule, also a root rule
+	`
+	g, err := NewGrammarFromString(grammarText)
+	if err != nil {
+		t.Errorf("Failed: %s", err)
+		return
+	}
+	t.Run("t1.ambiguity", func(t *testing.T) {
+		_, err := g.Eval(NewCharstreamFromString("123"), LevelBasic)
+		if err == nil || !strings.Contains(err.Error(), "ambiguity found") {
+			t.Errorf("Failed: expect an ambiguity error, got %v", err)
+			return
+		}
+		t.Logf("====> Passed: %s", err)
+	})
+	tester := func(t *testing.T, ast *AST, err error, expected string) {
+		if err != nil {
+			t.Errorf("Failed: %s", err)
+			return
+		}
+		if len(ast.Nodes) != 1 || ast.Nodes[0].RuleName != expected {
+			t.Errorf("Failed: expect 1 node of rule %s\n%s", expected, ast.StringTree(nil))
+			return
+		}
+		t.Logf("====> Passed")
+	}
+	t.Run("t2.evalFrom", func(t *testing.T) {
+		ast, err := g.EvalFrom("number", NewCharstreamFromString("-123"), LevelBasic)
+		tester(t, ast, err, "number")
+		ast, err = g.EvalFrom("test", NewCharstreamFromString("123"), LevelBasic)
+		tester(t, ast, err, "test")
+		_, err = g.EvalFrom("none", NewCharstreamFromString("123"), LevelBasic)
+		if err == nil {
+			t.Errorf("Failed: expect an undefined rule error")
+		}
+	})
+	t.Run("t3.directive", func(t *testing.T) {
+		g, err := NewGrammarFromString("@start number\n" + grammarText)
+		if err != nil {
+			t.Errorf("Failed: %s", err)
+			return
+		}
+		ast, err := g.Eval(NewCharstreamFromString("123"), LevelBasic)
+		tester(t, ast, err, "number")
+		_, err = NewGrammarFromString("@start none\n" + grammarText)
+		if err == nil || !strings.Contains(err.Error(), "start rule 'none' not defined") {
+			t.Errorf("Failed: expect undefined start rule error, got %v", err)
+		}
+	})
+	t.Run("t4.setStartRule", func(t *testing.T) {
+		g.SetStartRule("test")
+		ast, err := g.Eval(NewCharstreamFromString("123"), LevelBasic)
+		g.SetStartRule("")
+		tester(t, ast, err, "test")
+	})
 }